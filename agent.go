@@ -0,0 +1,225 @@
+package main
+
+import (
+	"github.com/yvasiyarov/newrelic_platform_go"
+	"log"
+	"sync"
+	"time"
+)
+
+//List of cores is refreshed and new handlers are discovered every 30 seconds
+const REFRESH_INTERVAL = 30
+
+//Keeps components of all monitored Solr hosts and cores and sends their metricas to sinks.
+//Every sink is run in separate goroutine with its own interval
+type SolrAgent struct {
+	Components []*SolrComponent
+	Monitors   []*SolrCoresMonitor
+	Sinks      []*SinkRunner
+	Verbose    bool
+	StartTime  time.Time
+	//pollers of data sources are started by Run, pollers of cores found later are started on adding
+	running bool
+
+	//time of the last finished refresh, main loop is stuck when it is too old.
+	//Guarded by its own lock, so it is available while refresh holds the main one
+	lastRefreshTime  time.Time
+	lastRefreshMutex sync.Mutex
+
+	//guards components and their data sources
+	mutex sync.Mutex
+}
+
+func NewSolrAgent(config *AgentConfig) *SolrAgent {
+	agent := &SolrAgent{
+		Components: make([]*SolrComponent, 0, len(config.Hosts)),
+		Monitors:   make([]*SolrCoresMonitor, 0),
+		Sinks:      make([]*SinkRunner, 0),
+		StartTime:  time.Now(),
+	}
+	for _, host := range config.Hosts {
+		if host.AllCores {
+			agent.Monitors = append(agent.Monitors, NewSolrCoresMonitor(agent, host))
+			continue
+		}
+		agent.addComponent(newSolrComponent(host.Name, NewMetricsDataSource(host, host.CoreName)))
+	}
+	return agent
+}
+
+func (agent *SolrAgent) AddSink(sink ISink, interval int) {
+	agent.Sinks = append(agent.Sinks, &SinkRunner{Sink: sink, Interval: interval})
+}
+
+func (agent *SolrAgent) addComponent(component *SolrComponent) {
+	agent.Components = append(agent.Components, component)
+	if agent.running {
+		agent.startComponent(component)
+	}
+}
+
+func (agent *SolrAgent) removeComponent(component *SolrComponent) {
+	components := make([]*SolrComponent, 0, len(agent.Components))
+	for _, c := range agent.Components {
+		if c != component {
+			components = append(components, c)
+		}
+	}
+	agent.Components = components
+	component.DataSource.Stop()
+}
+
+//Start poller of component. Handlers and caches are discovered as soon as first statistic
+//is polled, so first reports have their metricas without waiting for next refresh
+func (agent *SolrAgent) startComponent(component *SolrComponent) {
+	var onFirstData func()
+	if component.DataSource.Discover {
+		onFirstData = func() {
+			agent.mutex.Lock()
+			defer agent.mutex.Unlock()
+			component.DiscoverMetricas()
+		}
+	}
+	component.DataSource.Start(onFirstData)
+}
+
+//Refresh list of cores and discover new handlers and caches.
+//Cores are queried without agent lock, so metricas are read meanwhile
+func (agent *SolrAgent) Refresh() {
+	for _, monitor := range agent.Monitors {
+		coreNames, err := monitor.QueryCoreNames()
+		if err != nil {
+			log.Printf("Can not refresh list of Solr cores on %s: %v\n", monitor.Host.Name, err)
+			continue
+		}
+		agent.mutex.Lock()
+		monitor.UpdateCores(coreNames)
+		agent.mutex.Unlock()
+	}
+
+	agent.mutex.Lock()
+	for _, component := range agent.Components {
+		if component.DataSource.Discover {
+			component.DiscoverMetricas()
+		}
+	}
+	agent.mutex.Unlock()
+
+	agent.lastRefreshMutex.Lock()
+	agent.lastRefreshTime = time.Now()
+	agent.lastRefreshMutex.Unlock()
+}
+
+func (agent *SolrAgent) GetLastRefreshTime() time.Time {
+	agent.lastRefreshMutex.Lock()
+	defer agent.lastRefreshMutex.Unlock()
+	return agent.lastRefreshTime
+}
+
+//Read current values of all metricas
+func (agent *SolrAgent) Collect() []*MetricaSample {
+	agent.mutex.Lock()
+	defer agent.mutex.Unlock()
+
+	batch := make([]*MetricaSample, 0)
+	for _, component := range agent.Components {
+		for _, metrica := range component.Metricas {
+			sample, err := newMetricaSample(component, metrica)
+			if err != nil {
+				if agent.Verbose {
+					log.Printf("Can not get metrica: %v, got error:%v", metrica.GetName(), err)
+				}
+				continue
+			}
+			batch = append(batch, sample)
+		}
+	}
+	return batch
+}
+
+//All values of sample are read from one snapshot, so they are consistent while poller publishes new one
+func newMetricaSample(component *SolrComponent, metrica newrelic_platform_go.IMetrica) (*MetricaSample, error) {
+	snapshot := component.DataSource.Snapshot()
+	var value float64
+	var err error
+	if snapshotMetrica, ok := metrica.(ISnapshotMetrica); ok {
+		value, err = snapshotMetrica.GetSnapshotValue(snapshot)
+	} else {
+		value, err = metrica.GetValue()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sample := &MetricaSample{
+		Component:   component.Name,
+		Host:        component.DataSource.HostName,
+		Core:        component.DataSource.CoreName,
+		Name:        metrica.GetName(),
+		Units:       metrica.GetUnits(),
+		Value:       value,
+		RawValue:    value,
+		Timestamp:   snapshot.LastUpdateTime,
+		StartTime:   snapshot.CountersStartTime,
+		SolrVersion: snapshot.SolrVersion,
+	}
+	if availabilityMetrica, ok := metrica.(*AvailabilityMetrica); ok {
+		//failed poll does not update statistic, but updates availability
+		sample.Timestamp = snapshot.LastPollTime
+		sample.StatBlock = AVAILABILITY_STAT_BLOCK
+		sample.Key = availabilityMetrica.Key
+	}
+	if cacheMetrica, ok := metrica.(*CacheMetrica); ok {
+		sample.StatBlock = cacheMetrica.StatBlockKey
+		sample.Key = cacheMetrica.Value
+	}
+	if dataKey := metricaDataKey(metrica); dataKey != nil {
+		sample.StatBlock = dataKey.StatBlockKey
+		sample.Key = dataKey.KeyInsideStatBlock
+		if rateMetrica, ok := metrica.(*RateMetrica); ok {
+			//rate is derived from counter, so it gets its own key and has no previous value
+			sample.Key += "_per_" + rateMetrica.Rate
+			return sample, nil
+		}
+		sample.PrevValue, _, _ = snapshot.GetOriginalData(dataKey)
+		if _, ok := metrica.(*IncrementalMetrica); ok {
+			sample.Incremental = true
+			if sample.RawValue, err = snapshot.GetLastData(dataKey); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return sample, nil
+}
+
+//Location of metrica value inside Solr statistic
+func metricaDataKey(metrica newrelic_platform_go.IMetrica) *MetricaDataKey {
+	switch m := metrica.(type) {
+	case *Metrica:
+		return m.DataKey
+	case *IncrementalMetrica:
+		return m.DataKey
+	case *RateMetrica:
+		return m.DataKey
+	}
+	return nil
+}
+
+//Start pollers and sinks and refresh components until the process is stopped
+func (agent *SolrAgent) Run() {
+	agent.mutex.Lock()
+	agent.running = true
+	for _, component := range agent.Components {
+		agent.startComponent(component)
+	}
+	agent.mutex.Unlock()
+
+	agent.Refresh()
+	for _, runner := range agent.Sinks {
+		go runner.Run(agent)
+	}
+
+	for range time.Tick(REFRESH_INTERVAL * time.Second) {
+		agent.Refresh()
+	}
+}
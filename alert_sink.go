@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ALERT_STATUS_FIRING   = "firing"
+	ALERT_STATUS_RESOLVED = "resolved"
+
+	ALERT_WEBHOOK_TIMEOUT      = 10 //seconds
+	ALERT_MAX_PENDING          = 1000
+	ALERT_WEBHOOK_CONTENT_TYPE = "application/json"
+)
+
+//Metric name, comparison operator, threshold and optional number of intervals:
+//handler/errors/standard > 10 for 3 intervals
+var alertRuleRegexp = regexp.MustCompile(`^\s*([^<>=!]+?)\s*(>=|<=|==|!=|>|<)\s*([-+]?[0-9]*\.?[0-9]+(?:[eE][-+]?[0-9]+)?)(?:\s+for\s+([0-9]+)\s+intervals?)?\s*$`)
+
+//Condition over metrica value, which should hold during given number of consecutive polls to fire.
+//Incremental metricas are compared by their difference since previous interval
+type AlertRule struct {
+	Expression  string
+	MetricaName string
+	Operator    string
+	Threshold   float64
+	Intervals   int
+}
+
+func NewAlertRule(expression string) (*AlertRule, error) {
+	match := alertRuleRegexp.FindStringSubmatch(expression)
+	if match == nil {
+		return nil, fmt.Errorf("Invalid alert rule %s, should be like handler/errors/standard > 10 for 3 intervals\n", expression)
+	}
+
+	rule := &AlertRule{
+		Expression:  strings.TrimSpace(expression),
+		MetricaName: match[1],
+		Operator:    match[2],
+		Intervals:   1,
+	}
+	rule.Threshold, _ = strconv.ParseFloat(match[3], 64)
+	if match[4] != "" {
+		rule.Intervals, _ = strconv.Atoi(match[4])
+		if rule.Intervals < 1 {
+			return nil, fmt.Errorf("Invalid alert rule %s: number of intervals should be positive\n", expression)
+		}
+	}
+	return rule, nil
+}
+
+func NewAlertRules(expressions []string) ([]*AlertRule, error) {
+	rules := make([]*AlertRule, 0, len(expressions))
+	for _, expression := range expressions {
+		rule, err := NewAlertRule(expression)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func (rule *AlertRule) Match(value float64) bool {
+	switch rule.Operator {
+	case ">":
+		return value > rule.Threshold
+	case ">=":
+		return value >= rule.Threshold
+	case "<":
+		return value < rule.Threshold
+	case "<=":
+		return value <= rule.Threshold
+	case "==":
+		return value == rule.Threshold
+	case "!=":
+		return value != rule.Threshold
+	}
+	return false
+}
+
+//State of one rule for one Solr host or core
+type alertState struct {
+	Matches       int //number of consecutive polls, when condition holds
+	Firing        bool
+	FiredAt       time.Time
+	LastTimestamp time.Time //time of last evaluated poll, so the same poll is not counted twice
+}
+
+//Notification, posted to webhook as JSON on firing and on resolving of alert
+type AlertNotification struct {
+	Status    string    `json:"status"`
+	Rule      string    `json:"rule"`
+	Metric    string    `json:"metric"`
+	Units     string    `json:"units"`
+	Component string    `json:"component"`
+	Host      string    `json:"host"`
+	Core      string    `json:"core,omitempty"`
+	Value     float64   `json:"value"`
+	Operator  string    `json:"operator"`
+	Threshold float64   `json:"threshold"`
+	Intervals int       `json:"intervals"`
+	FiredAt   time.Time `json:"fired_at"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+//Evaluates alert rules every interval and notifies webhook about firing and resolved alerts.
+//Notifications, which could not be delivered, are resent on next interval.
+//Without webhook notifications are only logged
+type AlertSink struct {
+	Rules      []*AlertRule
+	WebhookUrl string
+
+	states  map[string]*alertState
+	pending []*AlertNotification
+	client  *http.Client
+}
+
+func NewAlertSink(rules []*AlertRule, webhookUrl string) *AlertSink {
+	return &AlertSink{
+		Rules:      rules,
+		WebhookUrl: webhookUrl,
+		states:     make(map[string]*alertState),
+		pending:    make([]*AlertNotification, 0),
+		client:     &http.Client{Timeout: ALERT_WEBHOOK_TIMEOUT * time.Second},
+	}
+}
+
+func (sink *AlertSink) GetName() string {
+	return "alerts"
+}
+
+//Batch is evaluated even when webhook fails, only notifications wait for delivery
+func (sink *AlertSink) Buffered() bool {
+	return true
+}
+
+func (sink *AlertSink) Send(batch []*MetricaSample) error {
+	for _, notification := range sink.Evaluate(batch) {
+		log.Printf("Alert %s %s on %s: value %s\n", notification.Status, notification.Rule, notification.Component, formatCheckValue(notification.Value))
+		if sink.WebhookUrl != "" {
+			sink.pending = append(sink.pending, notification)
+		}
+	}
+	if dropped := len(sink.pending) - ALERT_MAX_PENDING; dropped > 0 {
+		log.Printf("Too many undelivered alert notifications, %d oldest are dropped\n", dropped)
+		sink.pending = sink.pending[dropped:]
+	}
+
+	for len(sink.pending) > 0 {
+		if err := sink.post(sink.pending[0]); err != nil {
+			return fmt.Errorf("%d alert notifications are not delivered: %v", len(sink.pending), err)
+		}
+		sink.pending = sink.pending[1:]
+	}
+	return nil
+}
+
+//Update state of all rules and return notifications about changed alerts.
+//State of rule is kept, when its metrica is missing in batch or was not updated since previous evaluation
+func (sink *AlertSink) Evaluate(batch []*MetricaSample) []*AlertNotification {
+	notifications := make([]*AlertNotification, 0)
+	for _, rule := range sink.Rules {
+		for _, sample := range batch {
+			if sample.Name != rule.MetricaName {
+				continue
+			}
+
+			stateKey := rule.Expression + "\n" + sample.Component
+			state, ok := sink.states[stateKey]
+			if !ok {
+				state = &alertState{}
+				sink.states[stateKey] = state
+			}
+			timestamp := sampleTime(sample)
+			if !timestamp.After(state.LastTimestamp) {
+				continue
+			}
+			state.LastTimestamp = timestamp
+
+			if !rule.Match(sample.Value) {
+				state.Matches = 0
+				if state.Firing {
+					state.Firing = false
+					notifications = append(notifications, newAlertNotification(ALERT_STATUS_RESOLVED, rule, sample, state))
+				}
+				continue
+			}
+
+			state.Matches++
+			if !state.Firing && state.Matches >= rule.Intervals {
+				state.Firing = true
+				state.FiredAt = timestamp
+				notifications = append(notifications, newAlertNotification(ALERT_STATUS_FIRING, rule, sample, state))
+			}
+		}
+	}
+	return notifications
+}
+
+func sampleTime(sample *MetricaSample) time.Time {
+	if sample.Timestamp.IsZero() {
+		return time.Now()
+	}
+	return sample.Timestamp
+}
+
+func newAlertNotification(status string, rule *AlertRule, sample *MetricaSample, state *alertState) *AlertNotification {
+	return &AlertNotification{
+		Status:    status,
+		Rule:      rule.Expression,
+		Metric:    sample.Name,
+		Units:     sample.Units,
+		Component: sample.Component,
+		Host:      sample.Host,
+		Core:      sample.Core,
+		Value:     sample.Value,
+		Operator:  rule.Operator,
+		Threshold: rule.Threshold,
+		Intervals: rule.Intervals,
+		FiredAt:   state.FiredAt,
+		Timestamp: sampleTime(sample),
+	}
+}
+
+func (sink *AlertSink) post(notification *AlertNotification) error {
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+	response, err := sink.client.Post(sink.WebhookUrl, ALERT_WEBHOOK_CONTENT_TYPE, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode/100 != 2 {
+		responseBody, _ := ioutil.ReadAll(response.Body)
+		return fmt.Errorf("webhook returned %s: %s\n", response.Status, strings.TrimSpace(string(responseBody)))
+	}
+	return nil
+}
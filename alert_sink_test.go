@@ -0,0 +1,117 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewAlertRule(t *testing.T) {
+	tests := []struct {
+		expression string
+		name       string
+		operator   string
+		threshold  float64
+		intervals  int
+	}{
+		{"handler/errors/standard > 10", "handler/errors/standard", ">", 10, 1},
+		{"handler/errors/standard>10 for 3 intervals", "handler/errors/standard", ">", 10, 3},
+		{"  solr/restarts >= 1 for 1 interval  ", "solr/restarts", ">=", 1, 1},
+		{"solr/memory/system/commited virtual <= -1.5e3", "solr/memory/system/commited virtual", "<=", -1500, 1},
+		{"handler/cache/hitratio/filterCache < .5 for 10 intervals", "handler/cache/hitratio/filterCache", "<", 0.5, 10},
+		{"solr/availability == 0", "solr/availability", "==", 0, 1},
+		{"solr/availability != +1", "solr/availability", "!=", 1, 1},
+	}
+	for _, test := range tests {
+		rule, err := NewAlertRule(test.expression)
+		if err != nil {
+			t.Errorf("NewAlertRule(%q) failed: %v", test.expression, err)
+			continue
+		}
+		if rule.MetricaName != test.name || rule.Operator != test.operator || rule.Threshold != test.threshold || rule.Intervals != test.intervals {
+			t.Errorf("NewAlertRule(%q) = %q %s %v for %d, want %q %s %v for %d", test.expression,
+				rule.MetricaName, rule.Operator, rule.Threshold, rule.Intervals, test.name, test.operator, test.threshold, test.intervals)
+		}
+	}
+}
+
+func TestNewAlertRuleInvalid(t *testing.T) {
+	for _, expression := range []string{
+		"",
+		"handler/errors/standard",
+		"> 10",
+		"handler/errors/standard >> 10",
+		"handler/errors/standard => 10",
+		"handler/errors/standard > ten",
+		"handler/errors/standard > 10 for intervals",
+		"handler/errors/standard > 10 for 0 intervals",
+		"handler/errors/standard > 10 for -1 intervals",
+		"handler/errors/standard > 10 during 3 intervals",
+	} {
+		if _, err := NewAlertRule(expression); err == nil {
+			t.Errorf("NewAlertRule(%q) should fail", expression)
+		}
+	}
+}
+
+func TestAlertRuleMatch(t *testing.T) {
+	tests := []struct {
+		operator string
+		value    float64
+		match    bool
+	}{
+		{">", 11, true},
+		{">", 10, false},
+		{">=", 10, true},
+		{">=", 9, false},
+		{"<", 9, true},
+		{"<", 10, false},
+		{"<=", 10, true},
+		{"<=", 11, false},
+		{"==", 10, true},
+		{"==", 10.5, false},
+		{"!=", 10.5, true},
+		{"!=", 10, false},
+	}
+	for _, test := range tests {
+		rule := &AlertRule{Operator: test.operator, Threshold: 10}
+		if match := rule.Match(test.value); match != test.match {
+			t.Errorf("%v %s 10 is %v, want %v", test.value, test.operator, match, test.match)
+		}
+	}
+}
+
+func TestAlertSinkEvaluate(t *testing.T) {
+	rules, err := NewAlertRules([]string{"handler/errors/standard > 10 for 2 intervals"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink := NewAlertSink(rules, "")
+
+	tests := []struct {
+		value     float64
+		timestamp int64
+		status    string
+	}{
+		{11, 100, ""},
+		{11, 100, ""}, //the same poll is not counted twice
+		{12, 130, ALERT_STATUS_FIRING},
+		{13, 160, ""},
+		{1, 160, ""}, //value of evaluated poll does not resolve alert
+		{1, 190, ALERT_STATUS_RESOLVED},
+		{11, 220, ""},
+		{5, 250, ""},
+		{11, 280, ""},
+		{11, 310, ALERT_STATUS_FIRING},
+	}
+	for i, test := range tests {
+		sample := &MetricaSample{Component: "solr1", Name: "handler/errors/standard", Value: test.value, Timestamp: time.Unix(test.timestamp, 0)}
+		notifications := sink.Evaluate([]*MetricaSample{sample, {Component: "solr1", Name: "solr/restarts", Value: 100, Timestamp: sample.Timestamp}})
+		status := ""
+		if len(notifications) > 0 {
+			status = notifications[0].Status
+		}
+		if len(notifications) > 1 || status != test.status {
+			t.Errorf("Step %d: got %d notifications with status %q, want %q", i, len(notifications), status, test.status)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	COMMAND_CHECK  = "check"
+	CHECK_INTERVAL = 5 //seconds between two queries, so incremental metricas have deltas
+)
+
+//Create components for all configured hosts and cores without starting the agent.
+//Cores of all_cores hosts are queried once
+func newCheckComponents(config *AgentConfig) ([]*SolrComponent, []error) {
+	components := make([]*SolrComponent, 0, len(config.Hosts))
+	errors := make([]error, 0)
+	for _, host := range config.Hosts {
+		if !host.AllCores {
+			components = append(components, newSolrComponent(host.Name, NewMetricsDataSource(host, host.CoreName)))
+			continue
+		}
+
+		coreNames, err := NewSolrCoresMonitor(nil, host).QueryCoreNames()
+		if err != nil {
+			errors = append(errors, fmt.Errorf("Can not get list of Solr cores on %s: %v", host.Name, err))
+			continue
+		}
+		for _, coreName := range coreNames {
+			components = append(components, newSolrComponent(host.Name+"/"+coreName, NewMetricsDataSource(host, coreName)))
+		}
+	}
+	return components, errors
+}
+
+//Query data source right now, without background poller
+func checkQuery(component *SolrComponent) error {
+	if err := component.DataSource.Poll().Err(); err != nil {
+		return fmt.Errorf("Can not query %s: %v", component.Name, err)
+	}
+	return nil
+}
+
+//Query all components twice with pause, so incremental metricas have deltas.
+//Components, which could not be queried, are not returned
+func checkQueryTwice(components []*SolrComponent, interval int) ([]*SolrComponent, []error) {
+	errors := make([]error, 0)
+	failed := make(map[*SolrComponent]bool)
+	for i := 0; i < 2; i++ {
+		if i > 0 && len(failed) < len(components) {
+			time.Sleep(time.Duration(interval) * time.Second)
+		}
+		for _, component := range components {
+			if failed[component] {
+				continue
+			}
+			if err := checkQuery(component); err != nil {
+				errors = append(errors, err)
+				failed[component] = true
+			}
+		}
+	}
+
+	queried := make([]*SolrComponent, 0, len(components))
+	for _, component := range components {
+		if failed[component] {
+			continue
+		}
+		if component.DataSource.Discover {
+			component.DiscoverMetricas()
+		}
+		queried = append(queried, component)
+	}
+	return queried, errors
+}
+
+//Query all components twice, print table with values of all metricas and missing stat blocks.
+//Returns process exit code: 1 when any host could not be queried or parsed
+func RunCheck(config *AgentConfig, interval int, out io.Writer) int {
+	components, errors := newCheckComponents(config)
+	components, queryErrors := checkQueryTwice(components, interval)
+	errors = append(errors, queryErrors...)
+
+	for _, component := range components {
+		printCheckTable(component, out)
+	}
+
+	for _, err := range errors {
+		fmt.Fprintf(out, "ERROR: %v\n", strings.TrimSpace(err.Error()))
+	}
+	if len(errors) > 0 {
+		return 1
+	}
+	return 0
+}
+
+func printCheckTable(component *SolrComponent, out io.Writer) {
+	ds := component.DataSource
+	snapshot := ds.Snapshot()
+	fmt.Fprintf(out, "%s (%s, %s API)\n", component.Name, ds.CoreUrl(), snapshot.SolrApi)
+
+	writer := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(writer, "METRIC\tVALUE\tRAW VALUE\tUNITS")
+	missingBlocks := make(map[string]bool)
+	for _, metrica := range component.Metricas {
+		if dataKey := metricaDataKey(metrica); dataKey != nil {
+			if _, ok := snapshot.LastData[dataKey.StatBlockKey]; !ok {
+				missingBlocks[dataKey.StatBlockKey] = true
+				fmt.Fprintf(writer, "%s\t-\t-\t%s\n", metrica.GetName(), metrica.GetUnits())
+				continue
+			}
+		}
+
+		sample, err := newMetricaSample(component, metrica)
+		if err != nil {
+			fmt.Fprintf(writer, "%s\terror: %v\t-\t%s\n", metrica.GetName(), strings.TrimSpace(err.Error()), metrica.GetUnits())
+			continue
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\n", sample.Name, formatCheckValue(sample.Value), formatCheckValue(sample.RawValue), sample.Units)
+	}
+	writer.Flush()
+
+	if len(missingBlocks) > 0 {
+		names := make([]string, 0, len(missingBlocks))
+		for name := range missingBlocks {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		fmt.Fprintf(out, "Missing stat blocks: %s\n", strings.Join(names, ", "))
+	}
+	fmt.Fprintln(out)
+}
+
+func formatCheckValue(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	FILTER_RULE_PREFIX_SUFFIX = "*"   //"org.apache.solr.search.*" matches all classes in package
+	FILTER_RULE_REGEXP_PREFIX = "re:" //"re:.*Cache$" matches all classes, which names end with Cache
+)
+
+//Statistic of this classes is collected by default
+var defaultCollectedClasses = []string{
+	"org.apache.solr.handler.component.SearchHandler",
+	"org.apache.solr.handler.XmlUpdateRequestHandler",
+	"org.apache.solr.handler.UpdateRequestHandler",
+	"org.apache.solr.update.DirectUpdateHandler2",
+	"org.apache.solr.search.LRUCache",
+	"org.apache.solr.search.FastLRUCache",
+}
+
+//Rule matches string exactly, by prefix or by regular expression
+type FilterRule struct {
+	Exact    string
+	Prefix   string
+	IsPrefix bool
+	Regexp   *regexp.Regexp
+}
+
+func NewFilterRule(rule string) (*FilterRule, error) {
+	if strings.HasPrefix(rule, FILTER_RULE_REGEXP_PREFIX) {
+		re, err := regexp.Compile(strings.TrimPrefix(rule, FILTER_RULE_REGEXP_PREFIX))
+		if err != nil {
+			return nil, fmt.Errorf("Invalid filter rule %s: %v\n", rule, err)
+		}
+		return &FilterRule{Regexp: re}, nil
+	}
+	if strings.HasSuffix(rule, FILTER_RULE_PREFIX_SUFFIX) {
+		return &FilterRule{Prefix: strings.TrimSuffix(rule, FILTER_RULE_PREFIX_SUFFIX), IsPrefix: true}, nil
+	}
+	return &FilterRule{Exact: rule}, nil
+}
+
+func (rule *FilterRule) Match(value string) bool {
+	if rule.Regexp != nil {
+		return rule.Regexp.MatchString(value)
+	}
+	//"*" has empty prefix and matches everything
+	if rule.IsPrefix {
+		return strings.HasPrefix(value, rule.Prefix)
+	}
+	return rule.Exact == value
+}
+
+//Decides statistic of which Solr handlers and caches is collected.
+//Entry is collected, when its class is one of default classes or matches include rules,
+//and neither its class nor its name matches exclude rules
+type SolrClassFilter struct {
+	IncludeClasses []*FilterRule
+	ExcludeClasses []*FilterRule
+	IncludeNames   []*FilterRule
+	ExcludeNames   []*FilterRule
+}
+
+func NewSolrClassFilter(includeClasses, excludeClasses, includeNames, excludeNames []string) (*SolrClassFilter, error) {
+	filter := &SolrClassFilter{}
+	var err error
+	if filter.IncludeClasses, err = newFilterRules(append(append([]string{}, defaultCollectedClasses...), includeClasses...)); err != nil {
+		return nil, err
+	}
+	if filter.ExcludeClasses, err = newFilterRules(excludeClasses); err != nil {
+		return nil, err
+	}
+	if filter.IncludeNames, err = newFilterRules(includeNames); err != nil {
+		return nil, err
+	}
+	if filter.ExcludeNames, err = newFilterRules(excludeNames); err != nil {
+		return nil, err
+	}
+	return filter, nil
+}
+
+func newFilterRules(rules []string) ([]*FilterRule, error) {
+	result := make([]*FilterRule, 0, len(rules))
+	for _, rule := range rules {
+		filterRule, err := NewFilterRule(rule)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, filterRule)
+	}
+	return result, nil
+}
+
+func matchAny(rules []*FilterRule, value string) bool {
+	for _, rule := range rules {
+		if rule.Match(value) {
+			return true
+		}
+	}
+	return false
+}
+
+//In discovery mode all handlers and caches are included.
+//Entries without class name are filtered by exclude rules only
+func (filter *SolrClassFilter) IsCollected(category string, solrClassName string, name string, discover bool) bool {
+	if matchAny(filter.ExcludeClasses, solrClassName) || matchAny(filter.ExcludeNames, name) {
+		return false
+	}
+	if discover && category != "" {
+		return true
+	}
+	//metrics API does not report classes, so its entries are collected unless excluded by name
+	if solrClassName == "" {
+		return true
+	}
+	return matchAny(filter.IncludeClasses, solrClassName) || matchAny(filter.IncludeNames, name)
+}
+
+//Split comma separated list of filter rules, passed with command line option
+func splitFilterRules(rules string) []string {
+	result := make([]string, 0)
+	for _, rule := range strings.Split(rules, ",") {
+		if rule = strings.TrimSpace(rule); rule != "" {
+			result = append(result, rule)
+		}
+	}
+	return result
+}
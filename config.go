@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+)
+
+//Agent configuration file. Example:
+//	{
+//		"hosts": [
+//			{"name": "solr1", "url": "10.0.0.1:8983/solr/", "all_cores": true},
+//			{"name": "solr2", "url": "10.0.0.2:8983/solr/", "core": "products", "username": "monitor", "password": "secret", "poll_interval": 60, "rates": ["minute"]},
+//			{"name": "solr3", "url": "10.0.0.3:8983/solr/", "include_classes": ["org.apache.solr.search.CaffeineCache"], "exclude_names": ["/admin/*"]},
+//			{"name": "solr4", "url": "https://10.0.0.4:8984/solr/", "ca_file": "/etc/ssl/solr-ca.pem", "cert_file": "/etc/ssl/monitor.pem", "key_file": "/etc/ssl/monitor.key", "read_timeout": 10}
+//		]
+//	}
+type AgentConfig struct {
+	Hosts []*SolrHostConfig `json:"hosts"`
+}
+
+//Settings of one monitored Solr host
+type SolrHostConfig struct {
+	Name              string `json:"name"`
+	SolrUrl           string `json:"url"`
+	CoreName          string `json:"core"`
+	AllCores          bool   `json:"all_cores"`
+	Discover          bool   `json:"discover"`
+	SolrApi           string `json:"api"`
+	Username          string `json:"username"`
+	Password          string `json:"password"`
+	PollInterval      int    `json:"poll_interval"`
+	ConnectionTimeout int    `json:"connection_timeout"` //seconds
+	ReadTimeout       int    `json:"read_timeout"`       //seconds, including connection time
+
+	//HTTPS settings: CA bundle to verify Solr certificate and client certificate with its key in PEM format
+	CaFile             string       `json:"ca_file"`
+	CertFile           string       `json:"cert_file"`
+	KeyFile            string       `json:"key_file"`
+	InsecureSkipVerify bool         `json:"insecure_skip_verify"`
+	Client             *http.Client `json:"-"`
+
+	//Class filter rules: exact names, prefixes like "org.apache.solr.search.*" and regular expressions like "re:.*Cache$"
+	IncludeClasses []string         `json:"include_classes"`
+	ExcludeClasses []string         `json:"exclude_classes"`
+	IncludeNames   []string         `json:"include_names"`
+	ExcludeNames   []string         `json:"exclude_names"`
+	ClassFilter    *SolrClassFilter `json:"-"`
+
+	//Rate variants of incremental metricas: "second" and "minute"
+	Rates []string `json:"rates"`
+}
+
+func LoadConfig(fileName string) (*AgentConfig, error) {
+	content, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &AgentConfig{}
+	if err := json.Unmarshal(content, config); err != nil {
+		return nil, fmt.Errorf("Can not parse config file %s: %v\n", fileName, err)
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+//Check config and fill missed host settings with default values
+func (config *AgentConfig) Validate() error {
+	if len(config.Hosts) == 0 {
+		return fmt.Errorf("No Solr hosts configured\n")
+	}
+
+	names := make(map[string]bool, len(config.Hosts))
+	for i, host := range config.Hosts {
+		if host == nil {
+			return fmt.Errorf("Host #%d is empty\n", i+1)
+		}
+		if err := host.Validate(); err != nil {
+			return fmt.Errorf("Host #%d: %v", i+1, err)
+		}
+		if names[host.Name] {
+			return fmt.Errorf("Host #%d: name %s is used by several hosts\n", i+1, host.Name)
+		}
+		names[host.Name] = true
+	}
+	return nil
+}
+
+func (host *SolrHostConfig) Validate() error {
+	if host.SolrUrl == "" {
+		return fmt.Errorf("Solr url is required\n")
+	}
+	if host.Name == "" {
+		host.Name = host.SolrUrl
+	}
+	if host.SolrApi == "" {
+		host.SolrApi = SOLR_API_AUTO
+	}
+	if host.PollInterval == 0 {
+		host.PollInterval = MIN_PAUSE_TIME
+	}
+	if host.ConnectionTimeout == 0 {
+		host.ConnectionTimeout = SOLR_CONNECTION_TIMEOUT
+	}
+	if host.ReadTimeout == 0 {
+		host.ReadTimeout = SOLR_READ_TIMEOUT
+	}
+
+	if host.SolrApi != SOLR_API_AUTO && host.SolrApi != SOLR_API_STATS && host.SolrApi != SOLR_API_MBEANS && host.SolrApi != SOLR_API_METRICS {
+		return fmt.Errorf("Unknown Solr API: %s\n", host.SolrApi)
+	}
+	if host.AllCores && host.CoreName != "" {
+		return fmt.Errorf("Core name can not be used together with all cores monitoring\n")
+	}
+	if host.PollInterval < 0 {
+		return fmt.Errorf("Invalid poll interval: %d\n", host.PollInterval)
+	}
+	if host.ConnectionTimeout < 0 {
+		return fmt.Errorf("Invalid connection timeout: %d\n", host.ConnectionTimeout)
+	}
+	if host.ReadTimeout < 0 {
+		return fmt.Errorf("Invalid read timeout: %d\n", host.ReadTimeout)
+	}
+	for _, rate := range host.Rates {
+		if _, ok := ratePeriods[rate]; !ok {
+			return fmt.Errorf("Unknown rate period: %s, should be %s or %s\n", rate, RATE_PER_SECOND, RATE_PER_MINUTE)
+		}
+	}
+	if (host.CertFile == "") != (host.KeyFile == "") {
+		return fmt.Errorf("Both client certificate and key files should be set\n")
+	}
+
+	filter, err := NewSolrClassFilter(host.IncludeClasses, host.ExcludeClasses, host.IncludeNames, host.ExcludeNames)
+	if err != nil {
+		return err
+	}
+	host.ClassFilter = filter
+
+	client, err := NewSolrHttpClient(host)
+	if err != nil {
+		return err
+	}
+	host.Client = client
+	return nil
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+const (
+	COMMAND_DISCOVER = "discover"
+
+	DISCOVER_METRICA_PREFIX = "custom/"
+	DISCOVER_METRICA_UNITS  = "value"
+)
+
+//Selection of stat blocks and keys, printed by discover command
+type DiscoverSelection struct {
+	Blocks []*FilterRule
+	Keys   []*FilterRule
+}
+
+func NewDiscoverSelection(blocks []string, keys []string) (*DiscoverSelection, error) {
+	selection := &DiscoverSelection{}
+	var err error
+	if selection.Blocks, err = newFilterRules(blocks); err != nil {
+		return nil, err
+	}
+	if selection.Keys, err = newFilterRules(keys); err != nil {
+		return nil, err
+	}
+	return selection, nil
+}
+
+//Everything is selected when there are no rules
+func (selection *DiscoverSelection) IsSelected(block string, key string) bool {
+	if len(selection.Blocks) > 0 && !matchAny(selection.Blocks, block) {
+		return false
+	}
+	return len(selection.Keys) == 0 || matchAny(selection.Keys, key)
+}
+
+//Query every configured host and core once and print all stat blocks, classes and numeric keys with current values.
+//With skeleton option, metric definitions for selected keys are printed instead, in metrics file format.
+//Returns process exit code: 1 when any host could not be queried or parsed
+func RunDiscover(config *AgentConfig, selection *DiscoverSelection, skeleton bool, out io.Writer) int {
+	components, errors := newCheckComponents(config)
+
+	plain := make([]*Metrica, 0)
+	incremental := make([]*Metrica, 0)
+	for _, component := range components {
+		//all classes are listed, regardless of include and exclude rules
+		component.DataSource.ClassFilter, _ = NewSolrClassFilter([]string{FILTER_RULE_REGEXP_PREFIX + ".*"}, nil, nil, nil)
+		if err := checkQuery(component); err != nil {
+			errors = append(errors, err)
+			continue
+		}
+
+		if skeleton {
+			componentPlain, componentIncremental := discoverMetricas(component.DataSource.Snapshot().LastData, selection)
+			plain = append(plain, componentPlain...)
+			incremental = append(incremental, componentIncremental...)
+		} else {
+			printDiscoverTable(component, selection, out)
+		}
+	}
+
+	if skeleton {
+		content, err := DumpMetricas(uniqueMetricas(plain), uniqueMetricas(incremental))
+		if err != nil {
+			errors = append(errors, err)
+		} else {
+			fmt.Fprintln(out, string(content))
+		}
+	}
+
+	for _, err := range errors {
+		fmt.Fprintf(out, "ERROR: %v\n", strings.TrimSpace(err.Error()))
+	}
+	if len(errors) > 0 {
+		return 1
+	}
+	return 0
+}
+
+func sortedBlockNames(data SolrStatisticData) []string {
+	names := make([]string, 0, len(data))
+	for name := range data {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func printDiscoverTable(component *SolrComponent, selection *DiscoverSelection, out io.Writer) {
+	ds := component.DataSource
+	snapshot := ds.Snapshot()
+	fmt.Fprintf(out, "%s (%s, %s API)\n", component.Name, ds.CoreUrl(), snapshot.SolrApi)
+
+	writer := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(writer, "STAT BLOCK\tCLASS\tCATEGORY\tKEY\tVALUE")
+	for _, blockName := range sortedBlockNames(snapshot.LastData) {
+		block := snapshot.LastData[blockName]
+		for _, key := range block.GetKeys() {
+			if !selection.IsSelected(blockName, key) {
+				continue
+			}
+			fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\n", blockName, block.GetClassName(), block.GetCategory(), key, formatCheckValue(block.GetValue(key)))
+		}
+	}
+	writer.Flush()
+	fmt.Fprintln(out)
+}
+
+//Metrica definitions for selected keys. Counters become incremental metricas
+func discoverMetricas(data SolrStatisticData, selection *DiscoverSelection) ([]*Metrica, []*Metrica) {
+	plain := make([]*Metrica, 0)
+	incremental := make([]*Metrica, 0)
+	for _, blockName := range sortedBlockNames(data) {
+		for _, key := range data[blockName].GetKeys() {
+			if !selection.IsSelected(blockName, key) {
+				continue
+			}
+			metrica := &Metrica{
+				DataKey: &MetricaDataKey{
+					StatBlockKey:       blockName,
+					KeyInsideStatBlock: key,
+				},
+				Name:  DISCOVER_METRICA_PREFIX + strings.Trim(blockName, "/") + "/" + key,
+				Units: DISCOVER_METRICA_UNITS,
+			}
+			if isCounter(key) {
+				incremental = append(incremental, metrica)
+			} else {
+				plain = append(plain, metrica)
+			}
+		}
+	}
+	return plain, incremental
+}
+
+//Statistic values, which only grow until Solr restart, core reload or commit
+var discoverCounters = []string{
+	"requests",
+	"errors",
+	"timeouts",
+	"totalTime",
+	"commits",
+	"autocommits",
+	"cumulative_adds",
+	"cumulative_deletesById",
+	"cumulative_deletesByQuery",
+	"cumulative_errors",
+	"cumulative_lookups",
+	"cumulative_hits",
+	"cumulative_inserts",
+	"cumulative_evictions",
+	"jvm_upTimeMS",
+}
+
+func isCounter(key string) bool {
+	for _, counter := range discoverCounters {
+		if counter == key {
+			return true
+		}
+	}
+	return false
+}
+
+//Several cores usually have the same blocks, metrica is defined once
+func uniqueMetricas(metricas []*Metrica) []*Metrica {
+	names := make(map[string]bool, len(metricas))
+	result := make([]*Metrica, 0, len(metricas))
+	for _, metrica := range metricas {
+		if names[metrica.Name] {
+			continue
+		}
+		names[metrica.Name] = true
+		result = append(result, metrica)
+	}
+	return result
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	GRAPHITE_PROTOCOL_PLAINTEXT = "plaintext"
+	GRAPHITE_PROTOCOL_PICKLE    = "pickle"
+
+	GRAPHITE_CONNECTION_TIMEOUT = 5  //seconds
+	GRAPHITE_WRITE_TIMEOUT      = 10 //seconds
+	GRAPHITE_MAX_BUFFERED       = 100000
+	GRAPHITE_PICKLE_BATCH_SIZE  = 500
+)
+
+var graphiteInvalidChars = regexp.MustCompile("[^a-zA-Z0-9_-]+")
+
+type graphitePoint struct {
+	Path      string
+	Value     float64
+	Timestamp int64
+}
+
+//Sends metricas to Carbon. Points are buffered until they are written successfully,
+//so nothing is lost while Carbon is restarted
+type GraphiteSink struct {
+	Address  string
+	Protocol string
+	Prefix   string
+
+	connection net.Conn
+	buffer     []*graphitePoint
+}
+
+func NewGraphiteSink(address string, protocol string, prefix string) (*GraphiteSink, error) {
+	if protocol != GRAPHITE_PROTOCOL_PLAINTEXT && protocol != GRAPHITE_PROTOCOL_PICKLE {
+		return nil, fmt.Errorf("Unknown Graphite protocol: %s\n", protocol)
+	}
+	sink := &GraphiteSink{
+		Address:  address,
+		Protocol: protocol,
+		Prefix:   strings.Trim(prefix, "."),
+		buffer:   make([]*graphitePoint, 0),
+	}
+	return sink, nil
+}
+
+func (sink *GraphiteSink) GetName() string {
+	return "graphite"
+}
+
+//Points of failed batch stay in buffer until Carbon is available
+func (sink *GraphiteSink) Buffered() bool {
+	return true
+}
+
+//Graphite path of metrica: prefix, host, core and metrica name segments, separated by dots.
+//handler/cache/hitrates/filterCache of core products on solr1 becomes solr.solr1.products.handler.cache.hitrates.filterCache
+func graphitePath(prefix string, sample *MetricaSample) string {
+	segments := make([]string, 0)
+	if prefix != "" {
+		segments = append(segments, prefix)
+	}
+	segments = append(segments, graphiteSegment(sample.Host))
+	if sample.Core != "" {
+		segments = append(segments, graphiteSegment(sample.Core))
+	}
+	for _, part := range strings.Split(sample.Name, "/") {
+		if part != "" {
+			segments = append(segments, graphiteSegment(part))
+		}
+	}
+	return strings.Join(segments, ".")
+}
+
+func graphiteSegment(segment string) string {
+	return strings.Trim(graphiteInvalidChars.ReplaceAllString(segment, "_"), "_")
+}
+
+func (sink *GraphiteSink) Send(batch []*MetricaSample) error {
+	now := time.Now()
+	for _, sample := range batch {
+		if math.IsNaN(sample.Value) || math.IsInf(sample.Value, 0) {
+			continue
+		}
+		timestamp := sample.Timestamp
+		if timestamp.IsZero() {
+			timestamp = now
+		}
+		sink.buffer = append(sink.buffer, &graphitePoint{
+			Path:      graphitePath(sink.Prefix, sample),
+			Value:     sample.Value,
+			Timestamp: timestamp.Unix(),
+		})
+	}
+	if dropped := len(sink.buffer) - GRAPHITE_MAX_BUFFERED; dropped > 0 {
+		log.Printf("Graphite buffer is full, %d oldest points are dropped\n", dropped)
+		sink.buffer = sink.buffer[dropped:]
+	}
+
+	return sink.flush()
+}
+
+//Write all buffered points. On error connection is closed and points are kept for the next try
+func (sink *GraphiteSink) flush() error {
+	if sink.connection == nil {
+		connection, err := net.DialTimeout("tcp", sink.Address, GRAPHITE_CONNECTION_TIMEOUT*time.Second)
+		if err != nil {
+			return fmt.Errorf("%d points are buffered: %v", len(sink.buffer), err)
+		}
+		sink.connection = connection
+	}
+
+	for len(sink.buffer) > 0 {
+		size := len(sink.buffer)
+		if size > GRAPHITE_PICKLE_BATCH_SIZE {
+			size = GRAPHITE_PICKLE_BATCH_SIZE
+		}
+
+		var message []byte
+		if sink.Protocol == GRAPHITE_PROTOCOL_PICKLE {
+			message = graphitePickleMessage(sink.buffer[:size])
+		} else {
+			message = graphitePlaintextMessage(sink.buffer[:size])
+		}
+
+		sink.connection.SetWriteDeadline(time.Now().Add(GRAPHITE_WRITE_TIMEOUT * time.Second))
+		if _, err := sink.connection.Write(message); err != nil {
+			sink.connection.Close()
+			sink.connection = nil
+			return fmt.Errorf("%d points are buffered: %v", len(sink.buffer), err)
+		}
+		sink.buffer = sink.buffer[size:]
+	}
+	return nil
+}
+
+//One "path value timestamp" line per point
+func graphitePlaintextMessage(points []*graphitePoint) []byte {
+	var buffer bytes.Buffer
+	for _, point := range points {
+		buffer.WriteString(point.Path)
+		buffer.WriteByte(' ')
+		buffer.WriteString(strconv.FormatFloat(point.Value, 'f', -1, 64))
+		buffer.WriteByte(' ')
+		buffer.WriteString(strconv.FormatInt(point.Timestamp, 10))
+		buffer.WriteByte('\n')
+	}
+	return buffer.Bytes()
+}
+
+//List of (path, (timestamp, value)) tuples, serialized with pickle protocol 2
+//and prefixed with 4 byte big-endian length, as Carbon pickle receiver expects
+func graphitePickleMessage(points []*graphitePoint) []byte {
+	var payload bytes.Buffer
+	payload.Write([]byte{0x80, 0x02}) // PROTO 2
+	payload.WriteByte(']')            // EMPTY_LIST
+	payload.WriteByte('(')            // MARK
+	for _, point := range points {
+		payload.WriteByte('X') // BINUNICODE
+		binary.Write(&payload, binary.LittleEndian, uint32(len(point.Path)))
+		payload.WriteString(point.Path)
+		payload.WriteByte('J') // BININT
+		binary.Write(&payload, binary.LittleEndian, int32(point.Timestamp))
+		payload.WriteByte('G') // BINFLOAT
+		binary.Write(&payload, binary.BigEndian, math.Float64bits(point.Value))
+		payload.WriteByte(0x86) // TUPLE2: (timestamp, value)
+		payload.WriteByte(0x86) // TUPLE2: (path, (timestamp, value))
+	}
+	payload.WriteByte('e') // APPENDS
+	payload.WriteByte('.') // STOP
+
+	message := make([]byte, 4, 4+payload.Len())
+	binary.BigEndian.PutUint32(message, uint32(payload.Len()))
+	return append(message, payload.Bytes()...)
+}
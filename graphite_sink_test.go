@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestGraphitePath(t *testing.T) {
+	tests := []struct {
+		prefix string
+		sample *MetricaSample
+		path   string
+	}{
+		{"solr", &MetricaSample{Host: "solr1", Name: "solr/restarts"}, "solr.solr1.solr.restarts"},
+		{"", &MetricaSample{Host: "solr1", Core: "products", Name: "handler/cache/hitrates/filterCache"}, "solr1.products.handler.cache.hitrates.filterCache"},
+		{"solr", &MetricaSample{Host: "10.0.0.1:8983/solr/", Name: "handler/errors/org.apache.solr.handler.XmlUpdateRequestHandler"}, "solr.10_0_0_1_8983_solr.handler.errors.org_apache_solr_handler_XmlUpdateRequestHandler"},
+		{"solr", &MetricaSample{Host: "solr1", Name: "handler/requests//select"}, "solr.solr1.handler.requests.select"},
+	}
+	for _, test := range tests {
+		if path := graphitePath(test.prefix, test.sample); path != test.path {
+			t.Errorf("graphitePath(%q, %s) = %q, want %q", test.prefix, test.sample.Name, path, test.path)
+		}
+	}
+}
+
+func TestGraphitePlaintextMessage(t *testing.T) {
+	points := []*graphitePoint{
+		{Path: "a.b", Value: 1.5, Timestamp: 1000},
+		{Path: "c", Value: -2, Timestamp: 1400000000},
+	}
+	want := "a.b 1.5 1000\nc -2 1400000000\n"
+	if message := string(graphitePlaintextMessage(points)); message != want {
+		t.Errorf("graphitePlaintextMessage = %q, want %q", message, want)
+	}
+}
+
+//Expected messages are checked with pickle.loads of Python
+func TestGraphitePickleMessage(t *testing.T) {
+	tests := []struct {
+		points  []*graphitePoint
+		message string
+	}{
+		{
+			[]*graphitePoint{},
+			"0000000680025d28652e",
+		},
+		{
+			[]*graphitePoint{{Path: "a.b", Value: 1.5, Timestamp: 1000}},
+			"0000001e80025d285803000000612e624ae8030000473ff80000000000008686652e",
+		},
+		{
+			[]*graphitePoint{{Path: "solr.x", Value: -2, Timestamp: 1400000000}, {Path: "y", Value: 0, Timestamp: 0}},
+			"0000003780025d285806000000736f6c722e784a004e725347c00000000000000086865801000000794a000000004700000000000000008686652e",
+		},
+	}
+	for _, test := range tests {
+		if message := hex.EncodeToString(graphitePickleMessage(test.points)); message != test.message {
+			t.Errorf("graphitePickleMessage(%d points) = %s, want %s", len(test.points), message, test.message)
+		}
+	}
+}
+
+func TestGraphiteSinkBuffersUntilCarbonIsAvailable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+
+	sink, _ := NewGraphiteSink(address, GRAPHITE_PROTOCOL_PLAINTEXT, "solr")
+	sample := &MetricaSample{Host: "solr1", Name: "solr/restarts", Value: 1, Timestamp: time.Unix(1000, 0)}
+	if err := sink.Send([]*MetricaSample{sample}); err == nil {
+		t.Fatal("Send should fail, while Carbon is down")
+	}
+
+	listener, err = net.Listen("tcp", address)
+	if err != nil {
+		t.Skip("Can not listen on the same address again: ", err)
+	}
+	defer listener.Close()
+	lines := make(chan string, 2)
+	go func() {
+		connection, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer connection.Close()
+		reader := bufio.NewReader(connection)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			lines <- line
+		}
+	}()
+
+	sample.Timestamp = time.Unix(2000, 0)
+	if err := sink.Send([]*MetricaSample{sample}); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"solr.solr1.solr.restarts 1 1000\n", "solr.solr1.solr.restarts 1 2000\n"} {
+		if line := <-lines; line != want {
+			t.Errorf("Carbon received %q, want %q", line, want)
+		}
+	}
+}
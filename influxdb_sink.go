@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	INFLUXDB_STDOUT       = "-"
+	INFLUXDB_HTTP_TIMEOUT = 10 //seconds
+)
+
+//Writes metricas in InfluxDB line protocol: one measurement per stat block,
+//one field per key inside stat block and host and core tags.
+//Lines are sent to InfluxDB HTTP write API or written to file or stdout
+type InfluxdbSink struct {
+	Url      string
+	Database string
+	Writer   io.Writer
+
+	client *http.Client
+}
+
+type influxdbPoint struct {
+	Measurement string
+	Tags        string
+	Timestamp   int64
+	Fields      map[string]float64
+}
+
+func NewInfluxdbHttpSink(influxdbUrl string, database string) (*InfluxdbSink, error) {
+	if database == "" {
+		return nil, fmt.Errorf("InfluxDB database is not set\n")
+	}
+	if !strings.HasPrefix(influxdbUrl, "http://") && !strings.HasPrefix(influxdbUrl, "https://") {
+		influxdbUrl = "http://" + influxdbUrl
+	}
+	sink := &InfluxdbSink{
+		Url:      strings.TrimRight(influxdbUrl, "/"),
+		Database: database,
+		client:   &http.Client{Timeout: INFLUXDB_HTTP_TIMEOUT * time.Second},
+	}
+	return sink, nil
+}
+
+//Append lines to file. "-" means stdout, so agent can be run by Telegraf execd input
+func NewInfluxdbFileSink(fileName string) (*InfluxdbSink, error) {
+	if fileName == INFLUXDB_STDOUT {
+		return &InfluxdbSink{Writer: os.Stdout}, nil
+	}
+	file, err := os.OpenFile(fileName, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("Can not open InfluxDB output file: %v\n", err)
+	}
+	return &InfluxdbSink{Writer: file}, nil
+}
+
+func (sink *InfluxdbSink) GetName() string {
+	return "influxdb"
+}
+
+func (sink *InfluxdbSink) Send(batch []*MetricaSample) error {
+	lines := influxdbLines(batch)
+	if len(lines) == 0 {
+		return nil
+	}
+	if sink.Writer != nil {
+		_, err := sink.Writer.Write(lines)
+		return err
+	}
+	return sink.write(lines)
+}
+
+func (sink *InfluxdbSink) write(lines []byte) error {
+	writeUrl := sink.Url + "/write?db=" + url.QueryEscape(sink.Database)
+	response, err := sink.client.Post(writeUrl, "text/plain; charset=utf-8", bytes.NewReader(lines))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(response.Body)
+		return fmt.Errorf("InfluxDB returned %s: %s\n", response.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+//Group samples of the same stat block into one point. Raw values are written for incremental metricas,
+//InfluxDB calculates differences itself with derivative() and non_negative_difference()
+func influxdbLines(batch []*MetricaSample) []byte {
+	points := make(map[string]*influxdbPoint)
+	keys := make([]string, 0)
+	for _, sample := range batch {
+		if sample.StatBlock == "" || sample.Key == "" || math.IsNaN(sample.RawValue) || math.IsInf(sample.RawValue, 0) {
+			continue
+		}
+
+		tags := ",host=" + escapeInfluxdbKey(sample.Host)
+		if sample.Core != "" {
+			tags += ",core=" + escapeInfluxdbKey(sample.Core)
+		}
+		measurement := escapeInfluxdbMeasurement(sample.StatBlock)
+		timestamp := sample.Timestamp.Unix()
+		if sample.Timestamp.IsZero() {
+			timestamp = time.Now().Unix()
+		}
+
+		pointKey := measurement + tags + " " + strconv.FormatInt(timestamp, 10)
+		point, ok := points[pointKey]
+		if !ok {
+			point = &influxdbPoint{
+				Measurement: measurement,
+				Tags:        tags,
+				Timestamp:   timestamp,
+				Fields:      make(map[string]float64),
+			}
+			points[pointKey] = point
+			keys = append(keys, pointKey)
+		}
+		point.Fields[escapeInfluxdbKey(sample.Key)] = sample.RawValue
+	}
+
+	sort.Strings(keys)
+	var buffer bytes.Buffer
+	for _, pointKey := range keys {
+		point := points[pointKey]
+		fieldNames := make([]string, 0, len(point.Fields))
+		for name := range point.Fields {
+			fieldNames = append(fieldNames, name)
+		}
+		sort.Strings(fieldNames)
+
+		buffer.WriteString(point.Measurement)
+		buffer.WriteString(point.Tags)
+		for i, name := range fieldNames {
+			if i == 0 {
+				buffer.WriteByte(' ')
+			} else {
+				buffer.WriteByte(',')
+			}
+			buffer.WriteString(name)
+			buffer.WriteByte('=')
+			buffer.WriteString(strconv.FormatFloat(point.Fields[name], 'f', -1, 64))
+		}
+		fmt.Fprintf(&buffer, " %d\n", point.Timestamp*int64(time.Second))
+	}
+	return buffer.Bytes()
+}
+
+func escapeInfluxdbMeasurement(value string) string {
+	return strings.NewReplacer(",", "\\,", " ", "\\ ").Replace(value)
+}
+
+//Escaping of tag keys, tag values and field keys
+func escapeInfluxdbKey(value string) string {
+	return strings.NewReplacer(",", "\\,", "=", "\\=", " ", "\\ ").Replace(value)
+}
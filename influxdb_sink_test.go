@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestInfluxdbLines(t *testing.T) {
+	timestamp := time.Unix(100, 0)
+	tests := []struct {
+		name  string
+		batch []*MetricaSample
+		lines string
+	}{
+		{
+			"samples of one stat block are grouped into one point",
+			[]*MetricaSample{
+				{Host: "solr1", Core: "products", StatBlock: "queryResultCache", Key: "lookups", RawValue: 10, Value: 2, Incremental: true, Timestamp: timestamp},
+				{Host: "solr1", Core: "products", StatBlock: "queryResultCache", Key: "hitratio", RawValue: 0.5, Timestamp: timestamp},
+			},
+			"queryResultCache,host=solr1,core=products hitratio=0.5,lookups=10 100000000000\n",
+		},
+		{
+			"core tag is omitted for metricas of whole Solr",
+			[]*MetricaSample{
+				{Host: "solr1", StatBlock: "solr", Key: "jvm_memory_used", RawValue: 1024, Timestamp: timestamp},
+			},
+			"solr,host=solr1 jvm_memory_used=1024 100000000000\n",
+		},
+		{
+			"measurement, tags and field keys are escaped",
+			[]*MetricaSample{
+				{Host: "solr 1", Core: "a=b,c", StatBlock: "/select, all", Key: "avg time=x", RawValue: 1.25, Timestamp: timestamp},
+			},
+			"/select\\,\\ all,host=solr\\ 1,core=a\\=b\\,c avg\\ time\\=x=1.25 100000000000\n",
+		},
+		{
+			"points are sorted and split by timestamp",
+			[]*MetricaSample{
+				{Host: "solr1", StatBlock: "b", Key: "x", RawValue: 1, Timestamp: time.Unix(200, 0)},
+				{Host: "solr1", StatBlock: "a", Key: "x", RawValue: 2, Timestamp: timestamp},
+				{Host: "solr1", StatBlock: "a", Key: "x", RawValue: 3, Timestamp: time.Unix(200, 0)},
+			},
+			"a,host=solr1 x=2 100000000000\na,host=solr1 x=3 200000000000\nb,host=solr1 x=1 200000000000\n",
+		},
+		{
+			"samples without stat block or with invalid values are skipped",
+			[]*MetricaSample{
+				{Host: "solr1", Name: "solr/restarts", RawValue: 1, Timestamp: timestamp},
+				{Host: "solr1", StatBlock: "a", Key: "nan", RawValue: math.NaN(), Timestamp: timestamp},
+				{Host: "solr1", StatBlock: "a", Key: "inf", RawValue: math.Inf(1), Timestamp: timestamp},
+			},
+			"",
+		},
+	}
+	for _, test := range tests {
+		if lines := string(influxdbLines(test.batch)); lines != test.lines {
+			t.Errorf("%s: influxdbLines = %q, want %q", test.name, lines, test.lines)
+		}
+	}
+}
+
+func TestInfluxdbHttpSink(t *testing.T) {
+	var body, query, contentType string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		body = string(data)
+		query = r.URL.RawQuery
+		contentType = r.Header.Get("Content-Type")
+		if r.URL.Path != "/write" {
+			http.Error(w, "unknown path "+r.URL.Path, http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	sink, err := NewInfluxdbHttpSink(server.URL+"/", "solr stats")
+	if err != nil {
+		t.Fatal(err)
+	}
+	batch := []*MetricaSample{
+		{Host: "solr1", Core: "products", StatBlock: "/select", Key: "requests", RawValue: 42, Value: 2, Incremental: true, Timestamp: time.Unix(100, 0)},
+	}
+	if err := sink.Send(batch); err != nil {
+		t.Fatal(err)
+	}
+	if want := "/select,host=solr1,core=products requests=42 100000000000\n"; body != want {
+		t.Errorf("InfluxDB received %q, want %q", body, want)
+	}
+	if want := "db=solr+stats"; query != want {
+		t.Errorf("InfluxDB received query %q, want %q", query, want)
+	}
+	if want := "text/plain; charset=utf-8"; contentType != want {
+		t.Errorf("InfluxDB received content type %q, want %q", contentType, want)
+	}
+
+	body = ""
+	if err := sink.Send([]*MetricaSample{}); err != nil || body != "" {
+		t.Errorf("Empty batch should not be sent, got error %v and body %q", err, body)
+	}
+}
+
+func TestInfluxdbHttpSinkError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "database not found", http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	sink, _ := NewInfluxdbHttpSink(server.URL, "solr")
+	batch := []*MetricaSample{{Host: "solr1", StatBlock: "solr", Key: "jvm_memory_used", RawValue: 1, Timestamp: time.Unix(100, 0)}}
+	if err := sink.Send(batch); err == nil {
+		t.Error("Send should fail, when InfluxDB returns 404")
+	}
+
+	if _, err := NewInfluxdbHttpSink(server.URL, ""); err == nil {
+		t.Error("NewInfluxdbHttpSink should fail without database")
+	}
+}
+
+func TestInfluxdbFileSink(t *testing.T) {
+	var buffer bytes.Buffer
+	sink := &InfluxdbSink{Writer: &buffer}
+	batch := []*MetricaSample{{Host: "solr1", StatBlock: "solr", Key: "jvm_memory_used", RawValue: 1, Timestamp: time.Unix(100, 0)}}
+	if err := sink.Send(batch); err != nil {
+		t.Fatal(err)
+	}
+	if want := "solr,host=solr1 jvm_memory_used=1 100000000000\n"; buffer.String() != want {
+		t.Errorf("InfluxDB file received %q, want %q", buffer.String(), want)
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	JSON_STDOUT           = "-"
+	JSON_FILE_MAX_SIZE    = 100 //megabytes
+	JSON_FILE_MAX_BACKUPS = 5
+	JSON_FILE_PERMISSIONS = 0644
+	MEGABYTE              = 1024 * 1024
+)
+
+//Writes every poll as JSON lines: one object per Solr host or core with metricas updated by this poll,
+//so output can be analysed with jq or passed to other pipelines
+type JsonSink struct {
+	Writer io.Writer
+
+	//timestamp of last written value of every metrica, so snapshot is not written twice
+	lastTimestamps map[string]time.Time
+}
+
+type JsonPoll struct {
+	Timestamp   time.Time     `json:"timestamp"`
+	Component   string        `json:"component"`
+	Host        string        `json:"host"`
+	Core        string        `json:"core,omitempty"`
+	SolrVersion string        `json:"solr_version,omitempty"`
+	Metrics     []*JsonMetric `json:"metrics"`
+}
+
+type JsonMetric struct {
+	Name        string   `json:"name"`
+	Units       string   `json:"units"`
+	StatBlock   string   `json:"stat_block,omitempty"`
+	Key         string   `json:"key,omitempty"`
+	Incremental bool     `json:"incremental"`
+	Value       float64  `json:"value"`           //last value
+	Previous    float64  `json:"previous"`        //value on previous query
+	Delta       *float64 `json:"delta,omitempty"` //difference since previous poll, only for incremental metricas
+}
+
+func NewJsonSink(fileName string, maxSize int, maxBackups int) (*JsonSink, error) {
+	if fileName == JSON_STDOUT {
+		return &JsonSink{Writer: os.Stdout}, nil
+	}
+	file, err := NewRotatingFile(fileName, int64(maxSize)*MEGABYTE, maxBackups)
+	if err != nil {
+		return nil, err
+	}
+	return &JsonSink{Writer: file}, nil
+}
+
+func (sink *JsonSink) GetName() string {
+	return "json"
+}
+
+//Sink is called every interval, but only values of new polls are written
+func (sink *JsonSink) Send(batch []*MetricaSample) error {
+	if sink.lastTimestamps == nil {
+		sink.lastTimestamps = make(map[string]time.Time)
+	}
+	polls := make(map[string]*JsonPoll)
+	components := make([]string, 0)
+	written := make(map[string][]*MetricaSample)
+	for _, sample := range batch {
+		sampleKey := sample.Component + " " + sample.Name
+		if !sample.Timestamp.After(sink.lastTimestamps[sampleKey]) {
+			continue
+		}
+		written[sample.Component] = append(written[sample.Component], sample)
+
+		poll, ok := polls[sample.Component]
+		if !ok {
+			poll = &JsonPoll{
+				Timestamp:   sample.Timestamp,
+				Component:   sample.Component,
+				Host:        sample.Host,
+				Core:        sample.Core,
+				SolrVersion: sample.SolrVersion,
+				Metrics:     make([]*JsonMetric, 0),
+			}
+			polls[sample.Component] = poll
+			components = append(components, sample.Component)
+		}
+		if sample.Timestamp.After(poll.Timestamp) {
+			poll.Timestamp = sample.Timestamp
+		}
+
+		metric := &JsonMetric{
+			Name:        sample.Name,
+			Units:       sample.Units,
+			StatBlock:   sample.StatBlock,
+			Key:         sample.Key,
+			Incremental: sample.Incremental,
+			Value:       sample.RawValue,
+			Previous:    sample.PrevValue,
+		}
+		//counter difference is already corrected after Solr restart
+		if sample.Incremental {
+			delta := sample.Value
+			metric.Delta = &delta
+		}
+		poll.Metrics = append(poll.Metrics, metric)
+	}
+
+	sort.Strings(components)
+	for _, component := range components {
+		line, err := json.Marshal(polls[component])
+		if err != nil {
+			return err
+		}
+		if _, err := sink.Writer.Write(append(line, '\n')); err != nil {
+			return err
+		}
+		for _, sample := range written[component] {
+			sink.lastTimestamps[sample.Component+" "+sample.Name] = sample.Timestamp
+		}
+	}
+	return nil
+}
+
+//File, which is renamed to file.1 when it grows bigger than max size.
+//Older backups are shifted to file.2, file.3 and so on, the oldest one is removed
+type RotatingFile struct {
+	FileName   string
+	MaxSize    int64
+	MaxBackups int
+
+	file  *os.File
+	size  int64
+	mutex sync.Mutex
+}
+
+func NewRotatingFile(fileName string, maxSize int64, maxBackups int) (*RotatingFile, error) {
+	rotatingFile := &RotatingFile{FileName: fileName, MaxSize: maxSize, MaxBackups: maxBackups}
+	if err := rotatingFile.open(); err != nil {
+		return nil, err
+	}
+	return rotatingFile, nil
+}
+
+func (rotatingFile *RotatingFile) open() error {
+	file, err := os.OpenFile(rotatingFile.FileName, os.O_WRONLY|os.O_APPEND|os.O_CREATE, JSON_FILE_PERMISSIONS)
+	if err != nil {
+		return fmt.Errorf("Can not open output file: %v\n", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	rotatingFile.file = file
+	rotatingFile.size = info.Size()
+	return nil
+}
+
+func (rotatingFile *RotatingFile) Write(data []byte) (int, error) {
+	rotatingFile.mutex.Lock()
+	defer rotatingFile.mutex.Unlock()
+
+	if rotatingFile.file == nil {
+		if err := rotatingFile.open(); err != nil {
+			return 0, err
+		}
+	}
+	if rotatingFile.MaxSize > 0 && rotatingFile.size > 0 && rotatingFile.size+int64(len(data)) > rotatingFile.MaxSize {
+		if err := rotatingFile.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := rotatingFile.file.Write(data)
+	rotatingFile.size += int64(n)
+	return n, err
+}
+
+//If file can not be renamed, it is reopened and written further, so output is not lost
+func (rotatingFile *RotatingFile) rotate() error {
+	rotatingFile.file.Close()
+	rotatingFile.file = nil
+
+	var err error
+	if rotatingFile.MaxBackups > 0 {
+		os.Remove(rotatingFile.backupName(rotatingFile.MaxBackups))
+		for i := rotatingFile.MaxBackups - 1; i > 0; i-- {
+			os.Rename(rotatingFile.backupName(i), rotatingFile.backupName(i+1))
+		}
+		err = os.Rename(rotatingFile.FileName, rotatingFile.backupName(1))
+	} else {
+		err = os.Remove(rotatingFile.FileName)
+	}
+	if err != nil {
+		log.Printf("Can not rotate %s: %v\n", rotatingFile.FileName, err)
+	}
+	return rotatingFile.open()
+}
+
+func (rotatingFile *RotatingFile) backupName(number int) string {
+	return fmt.Sprintf("%s.%d", rotatingFile.FileName, number)
+}
@@ -1,50 +1,307 @@
 package main
 
 import (
+	"encoding/json"
 	"encoding/xml"
 	"fmt"
 	"io/ioutil"
+	"log"
+	"math"
 	"net/http"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
+const (
+	SOLR_API_AUTO    = "auto"    //probe admin/metrics and admin/mbeans first, fall back to admin/stats.jsp
+	SOLR_API_STATS   = "stats"   //admin/stats.jsp, Solr 1.x - 3.x
+	SOLR_API_MBEANS  = "mbeans"  //admin/mbeans, Solr 4 and later
+	SOLR_API_METRICS = "metrics" //admin/metrics, Solr 6.4 and later
+)
+
+//Statistic block with values, calculated by agent itself
+const AGENT_STAT_BLOCK = "agent"
+
+//Availability values of data source, reported even when Solr does not respond.
+//Outputs, which group values by stat block, get them in availability block
+const (
+	AVAILABILITY_STAT_BLOCK    = "availability"
+	AVAILABILITY_UP            = "up"
+	AVAILABILITY_HTTP_STATUS   = "http_status"
+	AVAILABILITY_RESPONSE_TIME = "response_time"
+)
+
+//Lifetime counters, which grow until Solr restart or core reload, by category of statistic block.
+//Other counters, like errors of update handler or cache lookups, are reset on commit, so they are not checked
+var restartCounters = map[string][]string{
+	SOLR_CATEGORY_QUERY_HANDLER: []string{
+		"requests",
+		"errors",
+		"timeouts",
+	},
+	SOLR_CATEGORY_UPDATE_HANDLER: []string{
+		"cumulative_adds",
+		"cumulative_deletesById",
+		"cumulative_deletesByQuery",
+		"cumulative_errors",
+	},
+	SOLR_CATEGORY_CACHE: []string{
+		"cumulative_lookups",
+		"cumulative_hits",
+		"cumulative_inserts",
+		"cumulative_evictions",
+	},
+	//system information
+	"": []string{
+		"jvm_upTimeMS",
+	},
+}
+
+//Start time of handlers and cores, changed on Solr restart or core reload
+var restartStartTimes = []string{
+	"handlerStart",
+	"startTime",
+}
+
+//Counters of cache, used to derive its hit ratio, eviction and insert rates.
+//Lifetime versions of them have cumulative_ prefix
+var cacheCounters = []string{
+	"lookups",
+	"hits",
+	"inserts",
+	"evictions",
+}
+
+//Reads statistic of one Solr host or core. Solr is queried by background poller every poll interval,
+//every poll publishes new immutable snapshot, so metricas are read without locking and never wait for Solr
 type MetricsDataSource struct {
+	HostName          string
 	SolrUrl           string
+	CoreName          string
+	SolrApi           string
+	Username          string
+	Password          string
+	PollInterval      int
+	Discover          bool
+	Rates             []string
+	ClassFilter       *SolrClassFilter
 	Port              int
 	ConnectionTimeout int
+	Client            *http.Client
+
+	//state of poller: API, detected in auto mode, is kept in SolrApi
+	SolrVersion  string
+	httpStatus   int
+	coreRegistry string //registry of the core in metrics API, so other cores of the node are not downloaded
+	stop         chan bool
+
+	snapshot atomic.Value
+}
+
+//Result of Solr polls. Snapshot is never changed after it is published,
+//next poll publishes its copy with new data
+type SolrSnapshot struct {
+	PreviousData       SolrStatisticData
+	LastData           SolrStatisticData
+	PreviousUpdateTime time.Time //time of poll, which returned PreviousData
+	LastUpdateTime     time.Time //time of last successful poll
+	Restarts           int
+	//first query after agent start or Solr restart, counters are accumulated since then
+	CountersStartTime time.Time
+	SolrVersion       string
+	SolrApi           string
 
-	PreviousData   SolrStatisticData
-	LastData       SolrStatisticData
-	LastUpdateTime time.Time
+	//poll diagnostics
+	LastPollTime     time.Time
+	LastPollDuration time.Duration
+	LastError        error
+	LastErrorTime    time.Time
+	Polls            int
+	Errors           int
+	//availability of Solr on last poll, previous statistic is kept when poll fails
+	Available  bool
+	HttpStatus int
 }
 
-func NewMetricsDataSource(solrUrl string, connectionTimeout int) *MetricsDataSource {
+func NewMetricsDataSource(host *SolrHostConfig, coreName string) *MetricsDataSource {
 	ds := &MetricsDataSource{
-		SolrUrl:           solrUrl,
-		ConnectionTimeout: connectionTimeout,
+		HostName:          host.Name,
+		SolrUrl:           host.SolrUrl,
+		CoreName:          coreName,
+		SolrApi:           host.SolrApi,
+		Username:          host.Username,
+		Password:          host.Password,
+		PollInterval:      host.PollInterval,
+		Discover:          host.Discover,
+		Rates:             host.Rates,
+		ClassFilter:       host.ClassFilter,
+		ConnectionTimeout: host.ConnectionTimeout,
+		Client:            host.Client,
 	}
+	if ds.ClassFilter == nil {
+		ds.ClassFilter, _ = NewSolrClassFilter(nil, nil, nil, nil)
+	}
+	if ds.Client == nil {
+		ds.Client, _ = NewSolrHttpClient(&SolrHostConfig{ConnectionTimeout: SOLR_CONNECTION_TIMEOUT, ReadTimeout: SOLR_READ_TIMEOUT})
+	}
+	if ds.PollInterval <= 0 {
+		ds.PollInterval = MIN_PAUSE_TIME
+	}
+	ds.snapshot.Store(&SolrSnapshot{SolrApi: ds.SolrApi})
 	return ds
 }
 
-func (ds *MetricsDataSource) CheckAndGetData(key *MetricaDataKey) (float64, error) {
-	if err := ds.CheckAndUpdateData(); err != nil {
+//Current snapshot, safe to call from any goroutine
+func (ds *MetricsDataSource) Snapshot() *SolrSnapshot {
+	return ds.snapshot.Load().(*SolrSnapshot)
+}
+
+//Start polling Solr in background: right now and then every poll interval.
+//When set, onFirstData is called by poller after the first successful poll
+func (ds *MetricsDataSource) Start(onFirstData func()) {
+	if ds.stop != nil {
+		return
+	}
+	ds.stop = make(chan bool)
+	go ds.runPoller(ds.stop, onFirstData)
+}
+
+//Stop background polling. Poll in progress is finished, but next one is not started
+func (ds *MetricsDataSource) Stop() {
+	if ds.stop != nil {
+		close(ds.stop)
+		ds.stop = nil
+	}
+}
+
+func (ds *MetricsDataSource) runPoller(stop chan bool, onFirstData func()) {
+	ticker := time.NewTicker(time.Duration(ds.PollInterval) * time.Second)
+	defer ticker.Stop()
+	for {
+		if snapshot := ds.Poll(); snapshot.Available && onFirstData != nil {
+			onFirstData()
+			onFirstData = nil
+		}
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+//Query Solr and publish new snapshot. Should be called by one goroutine only:
+//by background poller or directly, when poller is not started
+func (ds *MetricsDataSource) Poll() *SolrSnapshot {
+	last := ds.Snapshot()
+	snapshot := *last
+
+	startTime := time.Now()
+	newData, err := ds.QueryData()
+	snapshot.Polls++
+	snapshot.LastPollTime = startTime
+	snapshot.LastPollDuration = time.Since(startTime)
+	snapshot.SolrApi = ds.SolrApi
+	snapshot.HttpStatus = ds.httpStatus
+	if err == nil && newData == nil {
+		err = fmt.Errorf("Solr returned no statistic\n")
+	}
+	snapshot.Available = err == nil
+	if err != nil {
+		snapshot.Errors++
+		snapshot.LastError = err
+		snapshot.LastErrorTime = startTime
+		ds.snapshot.Store(&snapshot)
+		return &snapshot
+	}
+
+	if last.LastData == nil {
+		snapshot.PreviousData = newData
+		snapshot.PreviousUpdateTime = startTime
+		snapshot.CountersStartTime = startTime
+	} else if isRestarted(last.LastData, newData) {
+		//counters started from zero, so new data becomes a baseline
+		log.Printf("Solr restart detected on %s%s\n", ds.SolrUrl, ds.CoreName)
+		snapshot.Restarts++
+		snapshot.PreviousData = newData
+		snapshot.PreviousUpdateTime = startTime
+		snapshot.CountersStartTime = startTime
+		//Solr could be upgraded
+		ds.SolrVersion = ""
+	} else {
+		//after failed polls previous data is older than poll interval, rates take it into account
+		snapshot.PreviousData = last.LastData
+		snapshot.PreviousUpdateTime = last.LastUpdateTime
+	}
+	newData[AGENT_STAT_BLOCK] = &SolrHandlerStat{
+		Name:        AGENT_STAT_BLOCK,
+		ClassName:   AGENT_STAT_BLOCK,
+		MetricaData: map[string]float64{"restarts": float64(snapshot.Restarts)},
+	}
+	snapshot.LastData = newData
+	snapshot.LastUpdateTime = startTime
+	snapshot.SolrVersion = ds.SolrVersion
+	ds.snapshot.Store(&snapshot)
+	return &snapshot
+}
+
+//Statistic values are not reported, while Solr does not respond
+func (snapshot *SolrSnapshot) Err() error {
+	if snapshot.Available {
+		return nil
+	}
+	if snapshot.LastError != nil {
+		return snapshot.LastError
+	}
+	return fmt.Errorf("Solr was not queried yet\n")
+}
+
+//Difference of counter since previous poll
+func (snapshot *SolrSnapshot) GetData(key *MetricaDataKey) (float64, error) {
+	if err := snapshot.Err(); err != nil {
 		return 0, err
 	}
 
-	prev, last, err := ds.GetOriginalData(key)
+	prev, last, err := snapshot.GetOriginalData(key)
 
 	if err != nil {
 		return 0, err
 	}
+	//counter was reset since previous query, so all its value was gained after reset
+	if last < prev {
+		return last, nil
+	}
 	return last - prev, nil
 }
-func (ds *MetricsDataSource) CheckAndGetLastData(key *MetricaDataKey) (float64, error) {
-	if err := ds.CheckAndUpdateData(); err != nil {
+
+//Difference of counter since previous poll per period in seconds, by actual time between polls
+func (snapshot *SolrSnapshot) GetRate(key *MetricaDataKey, period int) (float64, error) {
+	delta, err := snapshot.GetData(key)
+	if err != nil {
+		return 0, err
+	}
+	elapsed, err := snapshot.elapsedSeconds()
+	if err != nil {
+		return 0, err
+	}
+	return delta / elapsed * float64(period), nil
+}
+
+//Actual time between two last successful polls
+func (snapshot *SolrSnapshot) elapsedSeconds() (float64, error) {
+	elapsed := snapshot.LastUpdateTime.Sub(snapshot.PreviousUpdateTime).Seconds()
+	if elapsed <= 0 {
+		return 0, fmt.Errorf("Rate is not known until second poll\n")
+	}
+	return elapsed, nil
+}
+func (snapshot *SolrSnapshot) GetLastData(key *MetricaDataKey) (float64, error) {
+	if err := snapshot.Err(); err != nil {
 		return 0, err
 	}
 
-	_, last, err := ds.GetOriginalData(key)
+	_, last, err := snapshot.GetOriginalData(key)
 
 	if err != nil {
 		return 0, err
@@ -52,12 +309,12 @@ func (ds *MetricsDataSource) CheckAndGetLastData(key *MetricaDataKey) (float64,
 	return last, nil
 }
 
-func (ds *MetricsDataSource) GetOriginalData(key *MetricaDataKey) (float64, float64, error) {
-	previousValueBlock, ok := ds.PreviousData[key.StatBlockKey]
+func (snapshot *SolrSnapshot) GetOriginalData(key *MetricaDataKey) (float64, float64, error) {
+	previousValueBlock, ok := snapshot.PreviousData[key.StatBlockKey]
 	if !ok {
 		return 0, 0, fmt.Errorf("Can not get data block from source \n")
 	}
-	currentValueBlock, ok := ds.LastData[key.StatBlockKey]
+	currentValueBlock, ok := snapshot.LastData[key.StatBlockKey]
 	if !ok {
 		return 0, 0, fmt.Errorf("Can not get data block from source \n")
 	}
@@ -65,49 +322,194 @@ func (ds *MetricsDataSource) GetOriginalData(key *MetricaDataKey) (float64, floa
 	return previousValueBlock.GetValue(key.KeyInsideStatBlock), currentValueBlock.GetValue(key.KeyInsideStatBlock), nil
 }
 
-func (ds *MetricsDataSource) CheckAndUpdateData() error {
-	startTime := time.Now()
-	if startTime.Sub(ds.LastUpdateTime) > time.Second*MIN_PAUSE_TIME {
-		newData, err := ds.QueryData()
-		if err != nil {
-			return err
+//Cache values, derived from differences of cache counters since previous poll:
+//hit ratio of lookups and evictions and inserts per second
+func (snapshot *SolrSnapshot) GetCacheValue(blockName string, value string) (float64, error) {
+	deltas, err := snapshot.cacheCounterDeltas(blockName)
+	if err != nil {
+		return 0, err
+	}
+
+	counter := ""
+	switch value {
+	case CACHE_HIT_RATIO:
+		lookups, lookupsOk := deltas["lookups"]
+		hits, hitsOk := deltas["hits"]
+		if !lookupsOk || !hitsOk {
+			return 0, fmt.Errorf("Cache %s has no lookups and hits counters\n", blockName)
+		}
+		if lookups == 0 {
+			return 0, fmt.Errorf("No lookups in %s since previous poll\n", blockName)
 		}
+		return math.Min(hits/lookups, 1), nil
+	case CACHE_EVICTION_RATE:
+		counter = "evictions"
+	case CACHE_INSERT_RATE:
+		counter = "inserts"
+	default:
+		return 0, fmt.Errorf("Unknown cache value %s\n", value)
+	}
+
+	delta, ok := deltas[counter]
+	if !ok {
+		return 0, fmt.Errorf("Cache %s has no %s counter\n", blockName, counter)
+	}
+	elapsed, err := snapshot.elapsedSeconds()
+	if err != nil {
+		return 0, err
+	}
+	return delta / elapsed * float64(ratePeriods[RATE_PER_SECOND]), nil
+}
+
+//Differences of cache counters since previous poll. Counters of current searcher are reset on commit,
+//so lifetime cumulative_* counters are used, when Solr reports them. Interval, during which counters
+//were reset, is skipped
+func (snapshot *SolrSnapshot) cacheCounterDeltas(blockName string) (map[string]float64, error) {
+	if err := snapshot.Err(); err != nil {
+		return nil, err
+	}
+	previousBlock, previousOk := snapshot.PreviousData[blockName]
+	lastBlock, lastOk := snapshot.LastData[blockName]
+	if !previousOk || !lastOk {
+		return nil, fmt.Errorf("Can not get data block from source \n")
+	}
 
-		if ds.PreviousData == nil {
-			ds.PreviousData = newData
-		} else {
-			ds.PreviousData = ds.LastData
+	prefix := ""
+	_, previousOk = previousBlock.LookupValue("cumulative_lookups")
+	_, lastOk = lastBlock.LookupValue("cumulative_lookups")
+	if previousOk && lastOk {
+		prefix = "cumulative_"
+	}
+
+	deltas := make(map[string]float64)
+	for _, counter := range cacheCounters {
+		previous, previousOk := previousBlock.LookupValue(prefix + counter)
+		last, lastOk := lastBlock.LookupValue(prefix + counter)
+		if !previousOk && !lastOk {
+			continue
 		}
-		ds.LastData = newData
-		ds.LastUpdateTime = startTime
+		if !previousOk || !lastOk || last < previous {
+			return nil, fmt.Errorf("Cache %s was reset since previous poll\n", blockName)
+		}
+		deltas[counter] = last - previous
+	}
+	return deltas, nil
+}
+
+//Availability of Solr is known after every poll, successful or not
+func (snapshot *SolrSnapshot) GetAvailability(key string) (float64, error) {
+	if snapshot.Polls == 0 {
+		return 0, fmt.Errorf("Solr was not queried yet\n")
 	}
 
-	// check uptime
-	// TODO: implement uptime check
-	//If uptime is less then in previous run - then server were restarted
-	/*
-		if prev, last, err := ds.GetOriginalData("uptime"); err != nil {
-			return err
-		} else {
-			if last < prev {
-				ds.PreviousData = ds.LastData
+	switch key {
+	case AVAILABILITY_UP:
+		if snapshot.Available {
+			return 1, nil
+		}
+		return 0, nil
+	case AVAILABILITY_HTTP_STATUS:
+		return float64(snapshot.HttpStatus), nil
+	case AVAILABILITY_RESPONSE_TIME:
+		return float64(snapshot.LastPollDuration) / float64(time.Millisecond), nil
+	}
+	return 0, fmt.Errorf("Unknown availability value %s\n", key)
+}
+
+//Solr restart(or core reload) is detected when start time of any handler or core changes,
+//or any lifetime counter of its block category becomes less
+func isRestarted(lastData SolrStatisticData, newData SolrStatisticData) bool {
+	for blockName, newBlock := range newData {
+		lastBlock, ok := lastData[blockName]
+		if !ok {
+			continue
+		}
+		for _, key := range restartStartTimes {
+			lastValue, lastOk := lastBlock.LookupValue(key)
+			newValue, newOk := newBlock.LookupValue(key)
+			if lastOk && newOk && newValue != lastValue {
+				return true
+			}
+		}
+		for _, key := range restartCounters[newBlock.GetCategory()] {
+			lastValue, lastOk := lastBlock.LookupValue(key)
+			newValue, newOk := newBlock.LookupValue(key)
+			if lastOk && newOk && newValue < lastValue {
+				return true
 			}
 		}
-	*/
-	return nil
+	}
+	return false
 }
 
-//Query Solr handlers statistics
+//Query Solr handlers statistics using configured API.
+//In auto mode API is detected on first successful query and used since then.
+//Next API is probed only when Solr does not have previous one, other errors are returned
+//and probing is repeated on next query, so unreachable Solr is not detected as old one
 func (ds *MetricsDataSource) QueryData() (SolrStatisticData, error) {
-	resp, err := http.Get("http://" + ds.SolrUrl + "admin/stats.jsp")
+	switch ds.SolrApi {
+	case SOLR_API_STATS, SOLR_API_MBEANS, SOLR_API_METRICS:
+		return ds.queryApi(ds.SolrApi)
+	}
+
+	var data SolrStatisticData
+	var err error
+	for _, api := range []string{SOLR_API_METRICS, SOLR_API_MBEANS, SOLR_API_STATS} {
+		data, err = ds.queryApi(api)
+		if err == nil && data != nil {
+			ds.SolrApi = api
+			return data, nil
+		}
+		if err != nil && !isSolrNotFound(err) {
+			return nil, err
+		}
+	}
+	return data, err
+}
+
+func (ds *MetricsDataSource) queryApi(api string) (SolrStatisticData, error) {
+	switch api {
+	case SOLR_API_STATS:
+		return ds.QueryStatsData()
+	case SOLR_API_MBEANS:
+		return ds.QueryMbeansData()
+	}
+	return ds.QueryMetricsApiData()
+}
+
+//Url of the monitored core. Without core name Solr url is used as is
+func (ds *MetricsDataSource) CoreUrl() string {
+	if ds.CoreName == "" {
+		return ds.SolrUrl
+	}
+	return ds.SolrUrl + ds.CoreName + "/"
+}
+
+func (ds *MetricsDataSource) get(url string) (*http.Response, error) {
+	return solrGet(ds.Client, url, ds.Username, ds.Password)
+}
+
+//Query statistic page. Status of its response is reported as Solr availability, 0 when Solr is unreachable
+func (ds *MetricsDataSource) getStatistic(url string) (*http.Response, error) {
+	resp, err := ds.get(url)
+	ds.httpStatus = 0
+	if err == nil {
+		ds.httpStatus = resp.StatusCode
+	}
+	return resp, err
+}
+
+//Query Solr handlers statistics from admin/stats.jsp page
+func (ds *MetricsDataSource) QueryStatsData() (SolrStatisticData, error) {
+	resp, err := ds.getStatistic(ds.CoreUrl() + "admin/stats.jsp")
 
 	if err != nil {
 		return nil, err
 	}
 
 	defer resp.Body.Close()
-	if resp.StatusCode != 200 {
-		return nil, nil
+	if err := checkSolrResponse(resp); err != nil {
+		return nil, err
 	}
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
@@ -121,26 +523,68 @@ func (ds *MetricsDataSource) QueryData() (SolrStatisticData, error) {
 	}
 
 	data := make(SolrStatisticData, len(response.SolrInfo.QueryHandler.QueryHandlerInfo)+len(response.SolrInfo.UpdateHandler.QueryHandlerInfo)+len(response.SolrInfo.CacheHandler.QueryHandlerInfo)+1)
-	parseQueryHandlers(response.SolrInfo.QueryHandler.QueryHandlerInfo, data)
-	parseQueryHandlers(response.SolrInfo.UpdateHandler.QueryHandlerInfo, data)
-	parseQueryHandlers(response.SolrInfo.CacheHandler.QueryHandlerInfo, data)
+	ds.parseQueryHandlers(SOLR_CATEGORY_QUERY_HANDLER, response.SolrInfo.QueryHandler.QueryHandlerInfo, data)
+	ds.parseQueryHandlers(SOLR_CATEGORY_UPDATE_HANDLER, response.SolrInfo.UpdateHandler.QueryHandlerInfo, data)
+	ds.parseQueryHandlers(SOLR_CATEGORY_CACHE, response.SolrInfo.CacheHandler.QueryHandlerInfo, data)
 
-	if stat, err := ds.QuerySystemData(); err == nil {
+	if stat, err := ds.QuerySystemData(); err == nil && stat != nil {
+		data["solr"] = stat
+	}
+	return data, nil
+}
+
+//Query Solr handlers statistics from admin/mbeans handler (Solr 4 and later)
+func (ds *MetricsDataSource) QueryMbeansData() (SolrStatisticData, error) {
+	resp, err := ds.getStatistic(ds.CoreUrl() + "admin/mbeans?stats=true&wt=json")
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+	if err := checkSolrResponse(resp); err != nil {
+		return nil, err
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	response := SolrMbeansResponse{}
+	err = json.Unmarshal(body, &response)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make(SolrStatisticData)
+	// solr-mbeans is a flat list of category names, each followed by its entries
+	for i := 0; i+1 < len(response.SolrMbeans); i += 2 {
+		var category string
+		if err := json.Unmarshal(response.SolrMbeans[i], &category); err != nil {
+			return nil, err
+		}
+		entries := make(map[string]*SolrMbeansInfo)
+		if err := json.Unmarshal(response.SolrMbeans[i+1], &entries); err != nil {
+			return nil, err
+		}
+		ds.parseMbeans(category, entries, data)
+	}
+
+	if stat, err := ds.QuerySystemData(); err == nil && stat != nil {
 		data["solr"] = stat
 	}
 	return data, nil
 }
 
 // parse statistic tag blocks
-func parseQueryHandlers(queryHandlerInfo []SolrQueryHandlerInfo, data SolrStatisticData) {
+func (ds *MetricsDataSource) parseQueryHandlers(category string, queryHandlerInfo []SolrQueryHandlerInfo, data SolrStatisticData) {
 	for _, handler := range queryHandlerInfo {
 		solrClassName := strings.TrimSpace(handler.ClassName)
-		if solrClassName != "org.apache.solr.handler.component.SearchHandler" && solrClassName != "org.apache.solr.handler.XmlUpdateRequestHandler" && solrClassName != "org.apache.solr.update.DirectUpdateHandler2" && solrClassName != "org.apache.solr.search.LRUCache" && solrClassName != "org.apache.solr.search.FastLRUCache" {
-
+		if !ds.ClassFilter.IsCollected(category, solrClassName, strings.TrimSpace(handler.Name), ds.Discover) {
 			continue
 		}
 
-		stat := &SolrHandlerStat{ClassName: solrClassName}
+		stat := &SolrHandlerStat{ClassName: solrClassName, Category: category}
 		err := stat.Parse(&handler)
 		if err != nil {
 			continue
@@ -149,17 +593,36 @@ func parseQueryHandlers(queryHandlerInfo []SolrQueryHandlerInfo, data SolrStatis
 	}
 }
 
+// parse entries of one admin/mbeans category
+func (ds *MetricsDataSource) parseMbeans(mbeansCategory string, entries map[string]*SolrMbeansInfo, data SolrStatisticData) {
+	for name, entry := range entries {
+		solrClassName := strings.TrimSpace(entry.ClassName)
+		category := normalizeCategory(mbeansCategory, name)
+		if !ds.ClassFilter.IsCollected(category, solrClassName, name, ds.Discover) {
+			continue
+		}
+
+		entry.Name = name
+		stat := &SolrHandlerStat{ClassName: solrClassName, Category: category}
+		err := stat.Parse(entry)
+		if err != nil {
+			continue
+		}
+		data[stat.GetName()] = stat
+	}
+}
+
 //Query solr system information - OS and JVM memory consumption
 func (ds *MetricsDataSource) QuerySystemData() (*SolrHandlerStat, error) {
-	resp, err := http.Get("http://" + ds.SolrUrl + "admin/system/")
+	resp, err := ds.get(ds.CoreUrl() + "admin/system/")
 
 	if err != nil {
 		return nil, err
 	}
 
 	defer resp.Body.Close()
-	if resp.StatusCode != 200 {
-		return nil, nil
+	if err := checkSolrResponse(resp); err != nil {
+		return nil, err
 	}
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
@@ -172,6 +635,9 @@ func (ds *MetricsDataSource) QuerySystemData() (*SolrHandlerStat, error) {
 		return nil, err
 	}
 
+	if version := response.SolrVersion(); version != "" {
+		ds.SolrVersion = version
+	}
 	stat := &SolrHandlerStat{ClassName: "solr"}
 	err = stat.Parse(&response)
 	if err == nil {
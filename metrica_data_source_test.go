@@ -0,0 +1,273 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testStatisticData(stats ...*SolrHandlerStat) SolrStatisticData {
+	data := make(SolrStatisticData)
+	for _, stat := range stats {
+		data[stat.Name] = stat
+	}
+	return data
+}
+
+func testStat(name string, category string, values map[string]float64) *SolrHandlerStat {
+	return &SolrHandlerStat{Name: name, Category: category, MetricaData: values}
+}
+
+func TestIsRestarted(t *testing.T) {
+	tests := []struct {
+		name      string
+		category  string
+		last      map[string]float64
+		new       map[string]float64
+		restarted bool
+	}{
+		{"/select", SOLR_CATEGORY_QUERY_HANDLER, map[string]float64{"requests": 10, "handlerStart": 100}, map[string]float64{"requests": 20, "handlerStart": 100}, false},
+		{"/select", SOLR_CATEGORY_QUERY_HANDLER, map[string]float64{"requests": 10, "handlerStart": 100}, map[string]float64{"requests": 20, "handlerStart": 200}, true},
+		{"core", "", map[string]float64{"startTime": 100}, map[string]float64{"startTime": 200}, true},
+		{"/select", SOLR_CATEGORY_QUERY_HANDLER, map[string]float64{"requests": 10}, map[string]float64{"requests": 5}, true},
+		{"/select", SOLR_CATEGORY_QUERY_HANDLER, map[string]float64{"timeouts": 3}, map[string]float64{"timeouts": 0}, true},
+		{"updateHandler", SOLR_CATEGORY_UPDATE_HANDLER, map[string]float64{"cumulative_adds": 100}, map[string]float64{"cumulative_adds": 10}, true},
+		{"filterCache", SOLR_CATEGORY_CACHE, map[string]float64{"cumulative_lookups": 100}, map[string]float64{"cumulative_lookups": 10}, true},
+		{"solr", "", map[string]float64{"jvm_upTimeMS": 100000}, map[string]float64{"jvm_upTimeMS": 500}, true},
+		//counters of current searcher and update log are reset on commit
+		{"filterCache", SOLR_CATEGORY_CACHE, map[string]float64{"lookups": 100, "cumulative_lookups": 100}, map[string]float64{"lookups": 0, "cumulative_lookups": 120}, false},
+		{"updateHandler", SOLR_CATEGORY_UPDATE_HANDLER, map[string]float64{"adds": 50, "errors": 2, "cumulative_adds": 100}, map[string]float64{"adds": 0, "errors": 0, "cumulative_adds": 100}, false},
+		{"searcher", "", map[string]float64{"numDocs": 100}, map[string]float64{"numDocs": 10}, false},
+		//start time or counter, which appeared or disappeared, is not a restart
+		{"/select", SOLR_CATEGORY_QUERY_HANDLER, map[string]float64{"requests": 10}, map[string]float64{"handlerStart": 200}, false},
+	}
+	for i, test := range tests {
+		lastData := testStatisticData(testStat(test.name, test.category, test.last))
+		newData := testStatisticData(testStat(test.name, test.category, test.new))
+		if restarted := isRestarted(lastData, newData); restarted != test.restarted {
+			t.Errorf("Case %d: %s %v -> %v is restart %v, want %v", i, test.name, test.last, test.new, restarted, test.restarted)
+		}
+	}
+
+	lastData := testStatisticData(testStat("/select", SOLR_CATEGORY_QUERY_HANDLER, map[string]float64{"requests": 10}))
+	newData := testStatisticData(testStat("/browse", SOLR_CATEGORY_QUERY_HANDLER, map[string]float64{"requests": 1}))
+	if isRestarted(lastData, newData) {
+		t.Error("New handler should not be treated as restart")
+	}
+}
+
+func TestGetDataAfterReset(t *testing.T) {
+	snapshot := &SolrSnapshot{Available: true}
+	snapshot.PreviousData = testStatisticData(testStat("updateHandler", SOLR_CATEGORY_UPDATE_HANDLER, map[string]float64{"adds": 50, "commits": 3}))
+	snapshot.LastData = testStatisticData(testStat("updateHandler", SOLR_CATEGORY_UPDATE_HANDLER, map[string]float64{"adds": 20, "commits": 5}))
+
+	tests := []struct {
+		key   string
+		value float64
+	}{
+		{"adds", 20}, //counter was reset, so all its value is gained since reset
+		{"commits", 2},
+	}
+	for _, test := range tests {
+		value, err := snapshot.GetData(&MetricaDataKey{StatBlockKey: "updateHandler", KeyInsideStatBlock: test.key})
+		if err != nil || value != test.value {
+			t.Errorf("GetData(updateHandler, %s) = %v, %v, want %v", test.key, value, err, test.value)
+		}
+	}
+}
+
+func TestPollDetectsRestart(t *testing.T) {
+	requests, handlerStart := 10, 1000
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/admin/mbeans") {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintf(w, `{"solr-mbeans":["QUERYHANDLER",{"/select":{"class":"org.apache.solr.handler.component.SearchHandler",`+
+			`"stats":{"requests":%d,"handlerStart":%d}}},"CACHE",{"filterCache":{"class":"org.apache.solr.search.FastLRUCache",`+
+			`"stats":{"lookups":%d,"cumulative_lookups":%d}}}]}`, requests, handlerStart, 100-requests, requests)
+	}))
+	defer server.Close()
+
+	host := &SolrHostConfig{Name: "solr1", SolrUrl: strings.TrimPrefix(server.URL, "http://") + "/solr/", SolrApi: SOLR_API_MBEANS}
+	if err := host.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	ds := NewMetricsDataSource(host, "")
+	steps := []struct {
+		requests     int
+		handlerStart int
+		restarts     int
+	}{
+		{10, 1000, 0},
+		{20, 1000, 0}, //cache lookups of new searcher are less, but it is not a restart
+		{3, 1000, 1},
+		{5, 2000, 2},
+		{8, 2000, 2},
+	}
+	for i, step := range steps {
+		requests, handlerStart = step.requests, step.handlerStart
+		snapshot := ds.Poll()
+		if err := snapshot.Err(); err != nil {
+			t.Fatal(err)
+		}
+		if snapshot.Restarts != step.restarts {
+			t.Errorf("Poll %d: %d restarts, want %d", i, snapshot.Restarts, step.restarts)
+		}
+		if value := snapshot.LastData[AGENT_STAT_BLOCK].GetValue("restarts"); value != float64(step.restarts) {
+			t.Errorf("Poll %d: agent/restarts = %v, want %d", i, value, step.restarts)
+		}
+	}
+}
+
+func TestGetRate(t *testing.T) {
+	pollTime := time.Unix(1000, 0)
+	tests := []struct {
+		name     string
+		elapsed  time.Duration
+		previous float64
+		last     float64
+		period   int
+		rate     float64
+	}{
+		{"poll on time", 30 * time.Second, 100, 130, 1, 1},
+		{"poll on time per minute", 30 * time.Second, 100, 130, 60, 60},
+		{"delayed poll", 45 * time.Second, 100, 130, 60, 40},
+		{"after two failed polls", 90 * time.Second, 100, 190, 1, 1},
+		{"counter reset", 30 * time.Second, 100, 15, 1, 0.5},
+	}
+	key := &MetricaDataKey{StatBlockKey: "/select", KeyInsideStatBlock: "requests"}
+	for _, test := range tests {
+		snapshot := &SolrSnapshot{Available: true, PreviousUpdateTime: pollTime, LastUpdateTime: pollTime.Add(test.elapsed)}
+		snapshot.PreviousData = testStatisticData(testStat("/select", SOLR_CATEGORY_QUERY_HANDLER, map[string]float64{"requests": test.previous}))
+		snapshot.LastData = testStatisticData(testStat("/select", SOLR_CATEGORY_QUERY_HANDLER, map[string]float64{"requests": test.last}))
+		if rate, err := snapshot.GetRate(key, test.period); err != nil || rate != test.rate {
+			t.Errorf("%s: rate is %v, %v, want %v", test.name, rate, err, test.rate)
+		}
+	}
+
+	//after restart new data is the baseline, so rate is not known until next poll
+	snapshot := &SolrSnapshot{Available: true, PreviousUpdateTime: pollTime, LastUpdateTime: pollTime}
+	snapshot.PreviousData = testStatisticData(testStat("/select", SOLR_CATEGORY_QUERY_HANDLER, map[string]float64{"requests": 5}))
+	snapshot.LastData = snapshot.PreviousData
+	if rate, err := snapshot.GetRate(key, 1); err == nil {
+		t.Errorf("Rate of baseline should fail, got %v", rate)
+	}
+	snapshot.Available = false
+	snapshot.LastError = fmt.Errorf("connection refused\n")
+	if _, err := snapshot.GetRate(key, 1); err == nil {
+		t.Error("Rate should fail, while Solr is not available")
+	}
+}
+
+func TestPollRateAfterFailures(t *testing.T) {
+	requests, available := 10, true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !available || !strings.HasSuffix(r.URL.Path, "/admin/mbeans") {
+			http.Error(w, "not available", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintf(w, `{"solr-mbeans":["QUERYHANDLER",{"/select":{"class":"org.apache.solr.handler.component.SearchHandler",`+
+			`"stats":{"requests":%d}}}]}`, requests)
+	}))
+	defer server.Close()
+
+	host := &SolrHostConfig{Name: "solr1", SolrUrl: strings.TrimPrefix(server.URL, "http://") + "/solr/", SolrApi: SOLR_API_MBEANS}
+	if err := host.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	ds := NewMetricsDataSource(host, "")
+	key := &MetricaDataKey{StatBlockKey: "/select", KeyInsideStatBlock: "requests"}
+
+	first := ds.Poll()
+	if _, err := first.GetRate(key, 1); err == nil {
+		t.Error("Rate should not be known after first poll")
+	}
+
+	available = false
+	for i := 0; i < 2; i++ {
+		time.Sleep(10 * time.Millisecond)
+		if ds.Poll().Err() == nil {
+			t.Fatal("Poll should fail")
+		}
+	}
+	available, requests = true, 40
+	snapshot := ds.Poll()
+	if !snapshot.PreviousUpdateTime.Equal(first.LastUpdateTime) {
+		t.Errorf("Previous data should be read by the last successful poll at %v, got %v", first.LastUpdateTime, snapshot.PreviousUpdateTime)
+	}
+	elapsed := snapshot.LastUpdateTime.Sub(first.LastUpdateTime).Seconds()
+	if elapsed < 0.02 {
+		t.Errorf("Time between successful polls is %v seconds, failed polls are not taken into account", elapsed)
+	}
+	if rate, err := snapshot.GetRate(key, 1); err != nil || rate != 30/elapsed {
+		t.Errorf("Rate after failed polls is %v, %v, want %v", rate, err, 30/elapsed)
+	}
+}
+
+func TestGetCacheValue(t *testing.T) {
+	pollTime := time.Unix(1000, 0)
+	tests := []struct {
+		name     string
+		previous map[string]float64
+		last     map[string]float64
+		ratio    float64
+		inserts  float64
+		fail     bool
+	}{
+		{"cumulative counters",
+			map[string]float64{"lookups": 100, "hits": 50, "inserts": 10, "cumulative_lookups": 1000, "cumulative_hits": 500, "cumulative_inserts": 100},
+			map[string]float64{"lookups": 250, "hits": 200, "inserts": 100, "cumulative_lookups": 1150, "cumulative_hits": 650, "cumulative_inserts": 190},
+			1, 3, false},
+		//new searcher has more lookups, than the old one, so only cumulative counters are right
+		{"commit",
+			map[string]float64{"lookups": 100, "hits": 50, "inserts": 10, "cumulative_lookups": 1000, "cumulative_hits": 500, "cumulative_inserts": 100},
+			map[string]float64{"lookups": 150, "hits": 60, "inserts": 50, "cumulative_lookups": 1250, "cumulative_hits": 650, "cumulative_inserts": 190},
+			0.6, 3, false},
+		{"counters of searcher without cumulative ones",
+			map[string]float64{"lookups": 100, "hits": 50, "inserts": 10},
+			map[string]float64{"lookups": 200, "hits": 90, "inserts": 40},
+			0.4, 1, false},
+		{"commit without cumulative counters",
+			map[string]float64{"lookups": 100, "hits": 90, "inserts": 10},
+			map[string]float64{"lookups": 120, "hits": 5, "inserts": 11},
+			0, 0, true},
+		{"restart",
+			map[string]float64{"lookups": 100, "hits": 50, "inserts": 10, "cumulative_lookups": 1000, "cumulative_hits": 500, "cumulative_inserts": 100},
+			map[string]float64{"lookups": 150, "hits": 60, "inserts": 50, "cumulative_lookups": 150, "cumulative_hits": 60, "cumulative_inserts": 50},
+			0, 0, true},
+		{"cumulative counters appeared",
+			map[string]float64{"lookups": 100, "hits": 50, "inserts": 10},
+			map[string]float64{"lookups": 200, "hits": 150, "inserts": 40, "cumulative_lookups": 1000, "cumulative_hits": 500, "cumulative_inserts": 100},
+			1, 1, false},
+	}
+	for _, test := range tests {
+		snapshot := &SolrSnapshot{Available: true, PreviousUpdateTime: pollTime, LastUpdateTime: pollTime.Add(30 * time.Second)}
+		snapshot.PreviousData = testStatisticData(testStat("filterCache", SOLR_CATEGORY_CACHE, test.previous))
+		snapshot.LastData = testStatisticData(testStat("filterCache", SOLR_CATEGORY_CACHE, test.last))
+		ratio, ratioErr := snapshot.GetCacheValue("filterCache", CACHE_HIT_RATIO)
+		inserts, insertsErr := snapshot.GetCacheValue("filterCache", CACHE_INSERT_RATE)
+		if test.fail {
+			if ratioErr == nil || insertsErr == nil {
+				t.Errorf("%s: hit ratio %v, insert rate %v should not be known", test.name, ratio, inserts)
+			}
+			continue
+		}
+		if ratioErr != nil || ratio != test.ratio {
+			t.Errorf("%s: hit ratio is %v, %v, want %v", test.name, ratio, ratioErr, test.ratio)
+		}
+		if insertsErr != nil || inserts != test.inserts {
+			t.Errorf("%s: insert rate is %v, %v, want %v", test.name, inserts, insertsErr, test.inserts)
+		}
+	}
+
+	snapshot := &SolrSnapshot{Available: true, PreviousUpdateTime: pollTime, LastUpdateTime: pollTime.Add(30 * time.Second)}
+	snapshot.PreviousData = testStatisticData(testStat("filterCache", SOLR_CATEGORY_CACHE, map[string]float64{"lookups": 10, "hits": 5, "cumulative_lookups": 100, "cumulative_hits": 50}))
+	snapshot.LastData = testStatisticData(testStat("filterCache", SOLR_CATEGORY_CACHE, map[string]float64{"lookups": 0, "hits": 0, "cumulative_lookups": 100, "cumulative_hits": 50}))
+	if ratio, err := snapshot.GetCacheValue("filterCache", CACHE_HIT_RATIO); err == nil {
+		t.Errorf("Hit ratio without lookups should not be known, got %v", ratio)
+	}
+}
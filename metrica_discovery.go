@@ -0,0 +1,185 @@
+package main
+
+import (
+	"github.com/yvasiyarov/newrelic_platform_go"
+	"log"
+	"strings"
+)
+
+//Replaced with name of discovered handler or cache
+const METRICA_NAME_PLACEHOLDER = "{name}"
+
+//Metricas, created for every discovered statistic block of given category.
+//StatBlockKey of templates is empty, it is set to the name of discovered block
+type MetricaTemplates struct {
+	Category    string
+	Plain       []*Metrica
+	Incremental []*Metrica
+}
+
+var discoveryTemplates = []*MetricaTemplates{
+	&MetricaTemplates{
+		Category: SOLR_CATEGORY_QUERY_HANDLER,
+		Plain: []*Metrica{
+			&Metrica{
+				DataKey: &MetricaDataKey{KeyInsideStatBlock: "avgRequestsPerSecond"},
+				Name:    "handler/request_per_second/" + METRICA_NAME_PLACEHOLDER,
+				Units:   "requests/seconds",
+			},
+			&Metrica{
+				DataKey: &MetricaDataKey{KeyInsideStatBlock: "avgTimePerRequest"},
+				Name:    "handler/time_per_request/" + METRICA_NAME_PLACEHOLDER,
+				Units:   "milliseconds",
+			},
+		},
+		Incremental: []*Metrica{
+			&Metrica{
+				DataKey: &MetricaDataKey{KeyInsideStatBlock: "requests"},
+				Name:    "handler/requests/" + METRICA_NAME_PLACEHOLDER,
+				Units:   "requests/seconds",
+			},
+			&Metrica{
+				DataKey: &MetricaDataKey{KeyInsideStatBlock: "errors"},
+				Name:    "handler/errors/" + METRICA_NAME_PLACEHOLDER,
+				Units:   "errors/seconds",
+			},
+			&Metrica{
+				DataKey: &MetricaDataKey{KeyInsideStatBlock: "timeouts"},
+				Name:    "handler/timeouts/" + METRICA_NAME_PLACEHOLDER,
+				Units:   "timeouts/seconds",
+			},
+		},
+	},
+	&MetricaTemplates{
+		Category: SOLR_CATEGORY_CACHE,
+		Plain: []*Metrica{
+			&Metrica{
+				DataKey: &MetricaDataKey{KeyInsideStatBlock: "hitratio"},
+				Name:    "handler/cache/hitrates/" + METRICA_NAME_PLACEHOLDER,
+				Units:   "ratio",
+			},
+			&Metrica{
+				DataKey: &MetricaDataKey{KeyInsideStatBlock: "cumulative_hitratio"},
+				Name:    "handler/cache/hitrates_cumulative/" + METRICA_NAME_PLACEHOLDER,
+				Units:   "ratio",
+			},
+			&Metrica{
+				DataKey: &MetricaDataKey{KeyInsideStatBlock: "size"},
+				Name:    "handler/cache/size/" + METRICA_NAME_PLACEHOLDER,
+				Units:   "items",
+			},
+		},
+		Incremental: []*Metrica{
+			&Metrica{
+				DataKey: &MetricaDataKey{KeyInsideStatBlock: "lookups"},
+				Name:    "handler/cache/" + METRICA_NAME_PLACEHOLDER + "/lookups",
+				Units:   "request/seconds",
+			},
+			&Metrica{
+				DataKey: &MetricaDataKey{KeyInsideStatBlock: "hits"},
+				Name:    "handler/cache/" + METRICA_NAME_PLACEHOLDER + "/hits",
+				Units:   "hits/seconds",
+			},
+			&Metrica{
+				DataKey: &MetricaDataKey{KeyInsideStatBlock: "inserts"},
+				Name:    "handler/cache/" + METRICA_NAME_PLACEHOLDER + "/inserts",
+				Units:   "inserts/seconds",
+			},
+			&Metrica{
+				DataKey: &MetricaDataKey{KeyInsideStatBlock: "evictions"},
+				Name:    "handler/cache/" + METRICA_NAME_PLACEHOLDER + "/evictions",
+				Units:   "evictions/seconds",
+			},
+		},
+	},
+}
+
+//Metricas of one Solr host or core.
+//In discovery mode metricas for new handlers and caches are added by DiscoverMetricas
+type SolrComponent struct {
+	Name             string
+	DataSource       *MetricsDataSource
+	Metricas         []newrelic_platform_go.IMetrica
+	MetricaNames     map[string]bool
+	DiscoveredBlocks map[string]bool
+}
+
+//Create component with all metricas, reading data from given data source
+func newSolrComponent(name string, dataSource *MetricsDataSource) *SolrComponent {
+	component := &SolrComponent{
+		Name:             name,
+		DataSource:       dataSource,
+		Metricas:         make([]newrelic_platform_go.IMetrica, 0, len(availabilityMetricas)+len(plainMetricas)+len(incrementalMetricas)),
+		MetricaNames:     make(map[string]bool),
+		DiscoveredBlocks: make(map[string]bool),
+	}
+	component.addMetricas(availabilityMetricasBuilder(availabilityMetricas, dataSource))
+	component.addMetricas(plainMetricasBuilder(plainMetricas, dataSource))
+	component.addMetricas(incrementalMetricasBuilder(incrementalMetricas, dataSource))
+	for _, blockName := range cacheStatBlocks {
+		component.addMetricas(cacheMetricasBuilder(cacheMetricasFromTemplates(cacheMetricaTemplates, blockName), dataSource))
+	}
+	return component
+}
+
+//Metricas with already used names are skipped
+func (component *SolrComponent) addMetricas(metricas []newrelic_platform_go.IMetrica) {
+	for _, m := range metricas {
+		if component.MetricaNames[m.GetName()] {
+			continue
+		}
+		component.MetricaNames[m.GetName()] = true
+		component.Metricas = append(component.Metricas, m)
+	}
+}
+
+//Add metricas for handlers and caches, which appeared in Solr statistic since last check
+func (component *SolrComponent) DiscoverMetricas() {
+	for blockName, block := range component.DataSource.Snapshot().LastData {
+		if component.DiscoveredBlocks[blockName] {
+			continue
+		}
+		for _, templates := range discoveryTemplates {
+			if templates.Category != block.GetCategory() {
+				continue
+			}
+			log.Printf("Discovered %s %s on %s\n", strings.ToLower(block.GetCategory()), blockName, component.Name)
+			component.addMetricas(plainMetricasBuilder(metricasFromTemplates(templates.Plain, blockName), component.DataSource))
+			component.addMetricas(incrementalMetricasBuilder(metricasFromTemplates(templates.Incremental, blockName), component.DataSource))
+		}
+		if block.GetCategory() == SOLR_CATEGORY_CACHE {
+			component.addMetricas(cacheMetricasBuilder(cacheMetricasFromTemplates(cacheMetricaTemplates, blockName), component.DataSource))
+		}
+		component.DiscoveredBlocks[blockName] = true
+	}
+}
+
+func metricasFromTemplates(templates []*Metrica, blockName string) []*Metrica {
+	nameInMetrica := strings.Trim(blockName, "/")
+	metricas := make([]*Metrica, len(templates))
+	for i, template := range templates {
+		metricas[i] = &Metrica{
+			DataKey: &MetricaDataKey{
+				StatBlockKey:       blockName,
+				KeyInsideStatBlock: template.DataKey.KeyInsideStatBlock,
+			},
+			Name:  strings.Replace(template.Name, METRICA_NAME_PLACEHOLDER, nameInMetrica, -1),
+			Units: template.Units,
+		}
+	}
+	return metricas
+}
+
+func cacheMetricasFromTemplates(templates []*CacheMetrica, blockName string) []*CacheMetrica {
+	nameInMetrica := strings.Trim(blockName, "/")
+	metricas := make([]*CacheMetrica, len(templates))
+	for i, template := range templates {
+		metricas[i] = &CacheMetrica{
+			StatBlockKey: blockName,
+			Value:        template.Value,
+			Name:         strings.Replace(template.Name, METRICA_NAME_PLACEHOLDER, nameInMetrica, -1),
+			Units:        template.Units,
+		}
+	}
+	return metricas
+}
@@ -1,5 +1,20 @@
 package main
 
+import (
+	"strings"
+)
+
+//Periods of rate variants of incremental metricas
+const (
+	RATE_PER_SECOND = "second"
+	RATE_PER_MINUTE = "minute"
+)
+
+var ratePeriods = map[string]int{
+	RATE_PER_SECOND: 1,
+	RATE_PER_MINUTE: 60,
+}
+
 type Metrica struct {
 	Name       string
 	Units      string
@@ -18,7 +33,10 @@ func (metrica *Metrica) GetUnits() string {
 	return metrica.Units
 }
 func (metrica *Metrica) GetValue() (float64, error) {
-	return metrica.DataSource.CheckAndGetLastData(metrica.DataKey)
+	return metrica.GetSnapshotValue(metrica.DataSource.Snapshot())
+}
+func (metrica *Metrica) GetSnapshotValue(snapshot *SolrSnapshot) (float64, error) {
+	return snapshot.GetLastData(metrica.DataKey)
 }
 
 type IncrementalMetrica struct {
@@ -26,10 +44,153 @@ type IncrementalMetrica struct {
 }
 
 func (metrica *IncrementalMetrica) GetValue() (float64, error) {
-	return metrica.DataSource.CheckAndGetData(metrica.DataKey)
+	return metrica.GetSnapshotValue(metrica.DataSource.Snapshot())
+}
+func (metrica *IncrementalMetrica) GetSnapshotValue(snapshot *SolrSnapshot) (float64, error) {
+	return snapshot.GetData(metrica.DataKey)
+}
+
+//Value of the counter itself, not its difference with previous value
+func (metrica *IncrementalMetrica) GetCounterValue() (float64, error) {
+	return metrica.DataSource.Snapshot().GetLastData(metrica.DataKey)
+}
+
+//Difference of counter, normalized by actual time between polls:
+//handler/errors/standard/per_minute is number of errors per minute, even when poll was delayed or failed
+type RateMetrica struct {
+	Metrica
+	Rate   string
+	Period int //seconds
+}
+
+func newRateMetrica(metrica *Metrica, rate string, dataSource *MetricsDataSource) *RateMetrica {
+	rateMetrica := &RateMetrica{Metrica: *metrica, Rate: rate, Period: ratePeriods[rate]}
+	rateMetrica.Name = metrica.Name + "/per_" + rate
+	rateMetrica.Units = strings.TrimSuffix(metrica.Units, "/seconds") + "/" + rate
+	rateMetrica.DataSource = dataSource
+	return rateMetrica
+}
+
+func (metrica *RateMetrica) GetValue() (float64, error) {
+	return metrica.GetSnapshotValue(metrica.DataSource.Snapshot())
+}
+func (metrica *RateMetrica) GetSnapshotValue(snapshot *SolrSnapshot) (float64, error) {
+	return snapshot.GetRate(metrica.DataKey, metrica.Period)
+}
+
+//Metrica, which is read from data source state instead of Solr statistic,
+//so it has value when Solr is down
+type AvailabilityMetrica struct {
+	Name       string
+	Units      string
+	Key        string
+	DataSource *MetricsDataSource
+}
+
+func (metrica *AvailabilityMetrica) GetName() string {
+	return metrica.Name
+}
+func (metrica *AvailabilityMetrica) GetUnits() string {
+	return metrica.Units
+}
+func (metrica *AvailabilityMetrica) GetValue() (float64, error) {
+	return metrica.GetSnapshotValue(metrica.DataSource.Snapshot())
+}
+func (metrica *AvailabilityMetrica) GetSnapshotValue(snapshot *SolrSnapshot) (float64, error) {
+	return snapshot.GetAvailability(metrica.Key)
+}
+
+//Metrica, which value is read from given snapshot of its data source
+type ISnapshotMetrica interface {
+	GetSnapshotValue(snapshot *SolrSnapshot) (float64, error)
+}
+
+//Cache values, calculated by agent from counter differences between two last polls.
+//Hit ratio of Solr itself is accumulated since last commit, this one is for last poll interval
+const (
+	CACHE_HIT_RATIO     = "hit_ratio"
+	CACHE_EVICTION_RATE = "eviction_rate"
+	CACHE_INSERT_RATE   = "insert_rate"
+)
+
+type CacheMetrica struct {
+	Name         string
+	Units        string
+	StatBlockKey string
+	Value        string
+	DataSource   *MetricsDataSource
+}
+
+func (metrica *CacheMetrica) GetName() string {
+	return metrica.Name
+}
+func (metrica *CacheMetrica) GetUnits() string {
+	return metrica.Units
+}
+func (metrica *CacheMetrica) GetValue() (float64, error) {
+	return metrica.GetSnapshotValue(metrica.DataSource.Snapshot())
+}
+func (metrica *CacheMetrica) GetSnapshotValue(snapshot *SolrSnapshot) (float64, error) {
+	return snapshot.GetCacheValue(metrica.StatBlockKey, metrica.Value)
+}
+
+//Caches, reported by default. Discovered caches get the same metricas
+var cacheStatBlocks = []string{
+	"queryResultCache",
+	"documentCache",
+	"fieldValueCache",
+	"filterCache",
+}
+
+//StatBlockKey of templates is set to the name of cache
+var cacheMetricaTemplates = []*CacheMetrica{
+	&CacheMetrica{
+		Value: CACHE_HIT_RATIO,
+		Name:  "handler/cache/" + METRICA_NAME_PLACEHOLDER + "/hit_ratio",
+		Units: "ratio",
+	},
+	&CacheMetrica{
+		Value: CACHE_EVICTION_RATE,
+		Name:  "handler/cache/" + METRICA_NAME_PLACEHOLDER + "/eviction_rate",
+		Units: "evictions/second",
+	},
+	&CacheMetrica{
+		Value: CACHE_INSERT_RATE,
+		Name:  "handler/cache/" + METRICA_NAME_PLACEHOLDER + "/insert_rate",
+		Units: "inserts/second",
+	},
+}
+
+var availabilityMetricas = []*AvailabilityMetrica{
+	// 1 when last poll returned statistic, 0 otherwise
+	&AvailabilityMetrica{
+		Key:   AVAILABILITY_UP,
+		Name:  "solr/availability/up",
+		Units: "up",
+	},
+	// HTTP status of last poll, 0 when Solr is unreachable
+	&AvailabilityMetrica{
+		Key:   AVAILABILITY_HTTP_STATUS,
+		Name:  "solr/availability/http_status",
+		Units: "status",
+	},
+	&AvailabilityMetrica{
+		Key:   AVAILABILITY_RESPONSE_TIME,
+		Name:  "solr/availability/response_time",
+		Units: "milliseconds",
+	},
 }
 
 var plainMetricas = []*Metrica{
+	// Solr restarts and core reloads, detected by agent
+	&Metrica{
+		DataKey: &MetricaDataKey{
+			StatBlockKey:       AGENT_STAT_BLOCK,
+			KeyInsideStatBlock: "restarts",
+		},
+		Name:  "solr/restarts",
+		Units: "restarts",
+	},
 	// Solr memory metrics
 	&Metrica{
 		DataKey: &MetricaDataKey{
@@ -55,6 +216,14 @@ var plainMetricas = []*Metrica{
 		Name:  "solr/memory/jvm/total",
 		Units: "bytes",
 	},
+	&Metrica{
+		DataKey: &MetricaDataKey{
+			StatBlockKey:       "solr",
+			KeyInsideStatBlock: "jvm_memory_used_percent",
+		},
+		Name:  "solr/memory/jvm/used_percent",
+		Units: "percent",
+	},
 	&Metrica{
 		DataKey: &MetricaDataKey{
 			StatBlockKey:       "solr",
@@ -128,7 +297,7 @@ var plainMetricas = []*Metrica{
 			KeyInsideStatBlock: "avgTimePerRequest",
 		},
 		Name:  "handler/time_per_request/spell",
-		Units: "seconds",
+		Units: "milliseconds",
 	},
 	&Metrica{
 		DataKey: &MetricaDataKey{
@@ -136,7 +305,7 @@ var plainMetricas = []*Metrica{
 			KeyInsideStatBlock: "avgTimePerRequest",
 		},
 		Name:  "handler/time_per_request/update",
-		Units: "seconds",
+		Units: "milliseconds",
 	},
 	&Metrica{
 		DataKey: &MetricaDataKey{
@@ -144,7 +313,7 @@ var plainMetricas = []*Metrica{
 			KeyInsideStatBlock: "avgTimePerRequest",
 		},
 		Name:  "handler/time_per_request/org.apache.solr.handler.XmlUpdateRequestHandler",
-		Units: "seconds",
+		Units: "milliseconds",
 	},
 	&Metrica{
 		DataKey: &MetricaDataKey{
@@ -152,7 +321,7 @@ var plainMetricas = []*Metrica{
 			KeyInsideStatBlock: "avgTimePerRequest",
 		},
 		Name:  "handler/time_per_request/standard",
-		Units: "seconds",
+		Units: "milliseconds",
 	},
 	&Metrica{
 		DataKey: &MetricaDataKey{
@@ -160,7 +329,7 @@ var plainMetricas = []*Metrica{
 			KeyInsideStatBlock: "avgTimePerRequest",
 		},
 		Name:  "handler/time_per_request/suggest",
-		Units: "seconds",
+		Units: "milliseconds",
 	},
 
     //Cache hitratio non cumulative
@@ -170,7 +339,7 @@ var plainMetricas = []*Metrica{
 			KeyInsideStatBlock: "hitratio",
 		},
 		Name:  "handler/cache/hitrates/queryResultCache",
-		Units: "seconds",
+		Units: "ratio",
 	},
 	&Metrica{
 		DataKey: &MetricaDataKey{
@@ -178,7 +347,7 @@ var plainMetricas = []*Metrica{
 			KeyInsideStatBlock: "hitratio",
 		},
 		Name:  "handler/cache/hitrates/documentCache",
-		Units: "seconds",
+		Units: "ratio",
 	},
 	&Metrica{
 		DataKey: &MetricaDataKey{
@@ -186,7 +355,7 @@ var plainMetricas = []*Metrica{
 			KeyInsideStatBlock: "hitratio",
 		},
 		Name:  "handler/cache/hitrates/fieldValueCache",
-		Units: "seconds",
+		Units: "ratio",
 	},
 	&Metrica{
 		DataKey: &MetricaDataKey{
@@ -194,7 +363,7 @@ var plainMetricas = []*Metrica{
 			KeyInsideStatBlock: "hitratio",
 		},
 		Name:  "handler/cache/hitrates/filterCache",
-		Units: "seconds",
+		Units: "ratio",
 	},
     //Cache hitratio cumulative
 	&Metrica{
@@ -203,7 +372,7 @@ var plainMetricas = []*Metrica{
 			KeyInsideStatBlock: "cumulative_hitratio",
 		},
 		Name:  "handler/cache/hitrates_cumulative/queryResultCache",
-		Units: "seconds",
+		Units: "ratio",
 	},
 	&Metrica{
 		DataKey: &MetricaDataKey{
@@ -211,7 +380,7 @@ var plainMetricas = []*Metrica{
 			KeyInsideStatBlock: "cumulative_hitratio",
 		},
 		Name:  "handler/cache/hitrates_cumulative/documentCache",
-		Units: "seconds",
+		Units: "ratio",
 	},
 	&Metrica{
 		DataKey: &MetricaDataKey{
@@ -219,7 +388,7 @@ var plainMetricas = []*Metrica{
 			KeyInsideStatBlock: "cumulative_hitratio",
 		},
 		Name:  "handler/cache/hitrates_cumulative/fieldValueCache",
-		Units: "seconds",
+		Units: "ratio",
 	},
 	&Metrica{
 		DataKey: &MetricaDataKey{
@@ -227,7 +396,7 @@ var plainMetricas = []*Metrica{
 			KeyInsideStatBlock: "cumulative_hitratio",
 		},
 		Name:  "handler/cache/hitrates_cumulative/filterCache",
-		Units: "seconds",
+		Units: "ratio",
 	},
     //Cache size
 	&Metrica{
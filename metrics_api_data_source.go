@@ -0,0 +1,299 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	SOLR_METRICS_REGISTRY_PREFIX      = "solr."
+	SOLR_METRICS_CORE_REGISTRY_PREFIX = "solr.core."
+)
+
+//Node-wide registries, which are requested together with registry of the monitored core
+var nodeRegistries = []string{
+	"solr.jvm",
+	"solr.node",
+	"solr.jetty",
+}
+
+//Request timer values are exposed under the same names, as admin/mbeans handler used
+//for request handlers in Solr 4 and 5
+var requestTimesAliases = map[string]string{
+	"meanRate":  "avgRequestsPerSecond",
+	"5minRate":  "5minRateReqsPerSecond",
+	"15minRate": "15minRateReqsPerSecond",
+	"mean_ms":   "avgTimePerRequest",
+	"median_ms": "medianRequestTime",
+	"p75_ms":    "75thPcRequestTime",
+	"p95_ms":    "95thPcRequestTime",
+	"p99_ms":    "99thPcRequestTime",
+	"p999_ms":   "999thPcRequestTime",
+}
+
+//Update handler statistic, renamed in metrics API
+var updateHandlerAliases = map[string]string{
+	"autoCommits":              "autocommits",
+	"cumulativeAdds":           "cumulative_adds",
+	"cumulativeDeletesById":    "cumulative_deletesById",
+	"cumulativeDeletesByQuery": "cumulative_deletesByQuery",
+	"cumulativeErrors":         "cumulative_errors",
+}
+
+//Query Solr metrics API (admin/metrics). It is node-wide, so Solr url should point to
+//Solr root (like 127.0.0.1:8983/solr/) and core is selected by core name.
+//First query reads all cores to find registry of the monitored one, next ones read only this registry
+func (ds *MetricsDataSource) QueryMetricsApiData() (SolrStatisticData, error) {
+	metrics, err := ds.queryMetricsApi()
+	if err != nil {
+		return nil, err
+	}
+
+	coreRegistry, err := ds.findCoreRegistry(metrics)
+	if err != nil && ds.coreRegistry != "" {
+		//registry was renamed, for example after core rename, so all cores are read again
+		ds.coreRegistry = ""
+		return ds.QueryMetricsApiData()
+	}
+	if err != nil {
+		return nil, err
+	}
+	ds.coreRegistry = coreRegistry
+
+	data := make(SolrStatisticData)
+	for registryName, registry := range metrics {
+		if strings.HasPrefix(registryName, SOLR_METRICS_CORE_REGISTRY_PREFIX) {
+			continue
+		}
+		stat := &SolrHandlerStat{Name: strings.TrimPrefix(registryName, SOLR_METRICS_REGISTRY_PREFIX), ClassName: registryName}
+		stat.MetricaData = make(map[string]float64, len(registry))
+		flattenMetrics("", registry, stat.MetricaData)
+		data[stat.GetName()] = stat
+	}
+	if jvm, ok := metrics[SOLR_METRICS_REGISTRY_PREFIX+"jvm"]; ok {
+		data["solr"] = parseJvmRegistry(jvm)
+	}
+	if coreRegistry != "" {
+		ds.parseCoreRegistry(metrics[coreRegistry], data)
+	}
+	if ds.SolrVersion == "" {
+		ds.SolrVersion = ds.querySolrVersion()
+	}
+	return data, nil
+}
+
+//Solr versions without registry parameter ignore it and return all registries
+func (ds *MetricsDataSource) metricsApiUrl() string {
+	metricsUrl := ds.SolrUrl + "admin/metrics?wt=json&compact=true"
+	if ds.coreRegistry == "" {
+		return metricsUrl + "&group=jvm,node,jetty,core"
+	}
+	for _, registry := range nodeRegistries {
+		metricsUrl += "&registry=" + url.QueryEscape(registry)
+	}
+	return metricsUrl + "&registry=" + url.QueryEscape(ds.coreRegistry)
+}
+
+func (ds *MetricsDataSource) queryMetricsApi() (map[string]map[string]interface{}, error) {
+	resp, err := ds.getStatistic(ds.metricsApiUrl())
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+	if err := checkSolrResponse(resp); err != nil {
+		return nil, err
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	response := SolrMetricsResponse{}
+	err = json.Unmarshal(body, &response)
+	if err != nil {
+		return nil, err
+	}
+	if response.Metrics == nil {
+		return nil, fmt.Errorf("Metrics API response does not contain metrics\n")
+	}
+	return response.Metrics, nil
+}
+
+//Metrics API does not report Solr version, so it is read from node-wide system info handler
+func (ds *MetricsDataSource) querySolrVersion() string {
+	resp, err := ds.get(ds.SolrUrl + "admin/info/system?wt=xml")
+	if err != nil {
+		return ""
+	}
+
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return ""
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return ""
+	}
+
+	response := SolrSystemResponse{}
+	if err := xml.Unmarshal(body, &response); err != nil {
+		return ""
+	}
+	return response.SolrVersion()
+}
+
+//Find registry of the monitored core. In SolrCloud registry name differs
+//from core name, so CORE.coreName gauge is checked too
+func (ds *MetricsDataSource) findCoreRegistry(metrics map[string]map[string]interface{}) (string, error) {
+	coreRegistries := make([]string, 0)
+	for registryName, registry := range metrics {
+		if !strings.HasPrefix(registryName, SOLR_METRICS_CORE_REGISTRY_PREFIX) {
+			continue
+		}
+		if ds.CoreName != "" {
+			if coreName, ok := registry["CORE.coreName"].(string); ok && coreName == ds.CoreName {
+				return registryName, nil
+			}
+			if registryName == SOLR_METRICS_CORE_REGISTRY_PREFIX+ds.CoreName {
+				return registryName, nil
+			}
+		}
+		coreRegistries = append(coreRegistries, registryName)
+	}
+
+	if ds.CoreName != "" {
+		return "", fmt.Errorf("Core %s not found in metrics API response\n", ds.CoreName)
+	}
+	switch len(coreRegistries) {
+	case 0:
+		return "", nil
+	case 1:
+		return coreRegistries[0], nil
+	}
+	sort.Strings(coreRegistries)
+	return "", fmt.Errorf("Solr hosts several cores(%s), core name should be specified\n", strings.Join(coreRegistries, ", "))
+}
+
+//Put all numeric metrics into result map, nested maps are flattened using dot as separator
+func flattenMetrics(prefix string, metrics map[string]interface{}, result map[string]float64) {
+	for name, metric := range metrics {
+		if value, ok := metricValue(metric); ok {
+			result[prefix+name] = value
+		} else if nested, ok := metric.(map[string]interface{}); ok {
+			flattenMetrics(prefix+name+".", nested, result)
+		}
+	}
+}
+
+func metricValue(metric interface{}) (float64, bool) {
+	switch value := metric.(type) {
+	case float64:
+		return value, true
+	case string:
+		if floatValue, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+			return floatValue, true
+		}
+	}
+	return 0, false
+}
+
+//Build "solr" block with the same keys, as admin/system handler provides
+func parseJvmRegistry(registry map[string]interface{}) *SolrHandlerStat {
+	stat := &SolrHandlerStat{Name: "Solr", ClassName: "solr"}
+	stat.MetricaData = make(map[string]float64, 12)
+
+	for name, metric := range registry {
+		if value, ok := metricValue(metric); ok && strings.HasPrefix(name, "os.") {
+			stat.MetricaData[strings.TrimPrefix(name, "os.")] = value
+		}
+	}
+
+	used, _ := metricValue(registry["memory.heap.used"])
+	committed, _ := metricValue(registry["memory.heap.committed"])
+	max, _ := metricValue(registry["memory.heap.max"])
+	stat.MetricaData["jvm_memory_used"] = used
+	stat.MetricaData["jvm_memory_total"] = committed
+	stat.MetricaData["jvm_memory_free"] = committed - used
+	stat.MetricaData["jvm_memory_max"] = max
+	setJvmMemoryUsedPercent(stat.MetricaData)
+	return stat
+}
+
+//Split core registry metrics into blocks named after handlers and caches.
+//Metric names look like CATEGORY.scope.name, for example QUERY./select.requests,
+//UPDATE.updateHandler.adds or CACHE.searcher.filterCache.
+//Handlers and caches are filtered by name, their classes are not reported by metrics API
+func (ds *MetricsDataSource) parseCoreRegistry(registry map[string]interface{}, data SolrStatisticData) {
+	core := &SolrHandlerStat{Name: "core", ClassName: "core"}
+	core.MetricaData = make(map[string]float64, len(registry))
+	flattenMetrics("", registry, core.MetricaData)
+	if startTime, ok := registry["CORE.startTime"].(string); ok {
+		if t, err := time.Parse(time.RFC3339, startTime); err == nil {
+			core.MetricaData["startTime"] = float64(t.Unix())
+		}
+	}
+	data[core.GetName()] = core
+
+	for name, metric := range registry {
+		nameParts := strings.SplitN(name, ".", 3)
+		if len(nameParts) < 3 {
+			continue
+		}
+		category, scope, metricName := nameParts[0], nameParts[1], nameParts[2]
+
+		blockName := scope
+		if category == "CACHE" {
+			blockName = metricName
+		}
+		if !ds.ClassFilter.IsCollected(normalizeCategory(category, blockName), "", blockName, ds.Discover) {
+			continue
+		}
+
+		if category == "CACHE" {
+			if cache, ok := metric.(map[string]interface{}); ok {
+				stat := getMetricsApiStat(data, metricName, category)
+				flattenMetrics("", cache, stat.MetricaData)
+			}
+			continue
+		}
+
+		stat := getMetricsApiStat(data, scope, category)
+		if value, ok := metricValue(metric); ok {
+			stat.MetricaData[metricName] = value
+		} else if nested, ok := metric.(map[string]interface{}); ok {
+			//meters and timers: count is the value of the metric itself
+			if count, ok := metricValue(nested["count"]); ok {
+				stat.MetricaData[metricName] = count
+			}
+			flattenMetrics(metricName+".", nested, stat.MetricaData)
+			if metricName == "requestTimes" {
+				for timerName, alias := range requestTimesAliases {
+					if value, ok := metricValue(nested[timerName]); ok {
+						stat.MetricaData[alias] = value
+					}
+				}
+			}
+		}
+		if alias, ok := updateHandlerAliases[metricName]; ok && scope == "updateHandler" {
+			stat.MetricaData[alias] = stat.MetricaData[metricName]
+		}
+	}
+}
+
+func getMetricsApiStat(data SolrStatisticData, name string, category string) *SolrHandlerStat {
+	if stat, ok := data[name].(*SolrHandlerStat); ok {
+		return stat
+	}
+	stat := &SolrHandlerStat{Name: name, ClassName: category, Category: normalizeCategory(category, name)}
+	stat.MetricaData = make(map[string]float64)
+	data[name] = stat
+	return stat
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+//Response of admin/metrics of a node with standalone core films and SolrCloud replica of collection books
+const metricsApiResponse = `{"responseHeader":{"status":0,"QTime":3},"metrics":{
+"solr.jvm":{"memory.heap.used":100,"memory.heap.committed":300,"memory.heap.max":1000,"os.freePhysicalMemorySize":5,"os.name":"Linux"},
+"solr.node":{"CONTAINER.cores.loaded":2},
+"solr.jetty":{"org.eclipse.jetty.server.handler.DefaultHandler.2xx-responses":{"count":17}},
+"solr.core.films":{"CORE.coreName":"films","CORE.startTime":"2020-01-02T03:04:05.000Z",
+"QUERY./select.requests":42,"QUERY./select.errors":{"count":3,"meanRate":0.1},
+"QUERY./select.requestTimes":{"count":42,"meanRate":1.5,"5minRate":1.25,"mean_ms":4.2,"median_ms":3,"p95_ms":15,"p99_ms":20},
+"QUERY./update/json.requests":5,
+"UPDATE.updateHandler.adds":7,"UPDATE.updateHandler.cumulativeAdds":{"count":70},"UPDATE.updateHandler.autoCommits":2,
+"UPDATE.updateHandler.cumulativeDeletesById":{"count":4},
+"CACHE.searcher.filterCache":{"lookups":10,"hits":5,"hitratio":0.5,"cumulative_lookups":100},
+"SEARCHER.searcher.numDocs":99,"INDEX.sizeInBytes":1234},
+"solr.core.books.shard1.replica_n1":{"CORE.coreName":"books_shard1_replica_n1","QUERY./select.requests":1}}}`
+
+func metricsApiServer(t *testing.T, queries *[]string) *httptest.Server {
+	response := struct {
+		Metrics map[string]json.RawMessage `json:"metrics"`
+	}{}
+	if err := json.Unmarshal([]byte(metricsApiResponse), &response); err != nil {
+		t.Fatal(err)
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/solr/admin/metrics" {
+			http.NotFound(w, r)
+			return
+		}
+		*queries = append(*queries, r.URL.RawQuery)
+		registries := r.URL.Query()["registry"]
+		if len(registries) == 0 {
+			w.Write([]byte(metricsApiResponse))
+			return
+		}
+		selected := make(map[string]json.RawMessage)
+		for _, registry := range registries {
+			if metrics, ok := response.Metrics[registry]; ok {
+				selected[registry] = metrics
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"metrics": selected})
+	}))
+}
+
+func TestFindCoreRegistry(t *testing.T) {
+	response := SolrMetricsResponse{}
+	if err := json.Unmarshal([]byte(metricsApiResponse), &response); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		coreName string
+		registry string
+		fail     bool
+	}{
+		{"films", "solr.core.films", false},
+		{"books_shard1_replica_n1", "solr.core.books.shard1.replica_n1", false},
+		{"missing", "", true},
+		{"", "", true}, //several cores on node
+	}
+	for _, test := range tests {
+		ds := &MetricsDataSource{CoreName: test.coreName}
+		registry, err := ds.findCoreRegistry(response.Metrics)
+		if registry != test.registry || (err != nil) != test.fail {
+			t.Errorf("findCoreRegistry for core %q = %q, %v, want %q", test.coreName, registry, err, test.registry)
+		}
+	}
+
+	single := map[string]map[string]interface{}{"solr.jvm": {}, "solr.core.films": {}}
+	if registry, err := (&MetricsDataSource{}).findCoreRegistry(single); err != nil || registry != "solr.core.films" {
+		t.Errorf("Only core should be selected without core name, got %q, %v", registry, err)
+	}
+}
+
+func TestQueryMetricsApiData(t *testing.T) {
+	queries := make([]string, 0)
+	server := metricsApiServer(t, &queries)
+	defer server.Close()
+
+	host := &SolrHostConfig{Name: "solr1", SolrUrl: strings.TrimPrefix(server.URL, "http://") + "/solr/", SolrApi: SOLR_API_METRICS}
+	if err := host.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	ds := NewMetricsDataSource(host, "films")
+	data, err := ds.QueryData()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		block string
+		key   string
+		value float64
+	}{
+		{"solr", "jvm_memory_used", 100},
+		{"solr", "jvm_memory_free", 200},
+		{"solr", "jvm_memory_used_percent", 10},
+		{"solr", "freePhysicalMemorySize", 5},
+		{"node", "CONTAINER.cores.loaded", 2},
+		{"core", "startTime", 1577934245},
+		{"core", "INDEX.sizeInBytes", 1234},
+		{"/select", "requests", 42},
+		{"/select", "errors", 3},
+		{"/select", "errors.meanRate", 0.1},
+		{"/select", "requestTimes", 42},
+		{"/select", "avgRequestsPerSecond", 1.5},
+		{"/select", "5minRateReqsPerSecond", 1.25},
+		{"/select", "avgTimePerRequest", 4.2},
+		{"/select", "medianRequestTime", 3},
+		{"/select", "95thPcRequestTime", 15},
+		{"/select", "99thPcRequestTime", 20},
+		{"/update/json", "requests", 5},
+		{"updateHandler", "adds", 7},
+		{"updateHandler", "cumulative_adds", 70},
+		{"updateHandler", "cumulative_deletesById", 4},
+		{"updateHandler", "autocommits", 2},
+		{"filterCache", "hitratio", 0.5},
+		{"filterCache", "cumulative_lookups", 100},
+		{"searcher", "numDocs", 99},
+	}
+	for _, test := range tests {
+		block, ok := data[test.block]
+		if !ok {
+			t.Errorf("Block %s is missing", test.block)
+			continue
+		}
+		if value, ok := block.LookupValue(test.key); !ok || value != test.value {
+			t.Errorf("%s/%s = %v, want %v", test.block, test.key, value, test.value)
+		}
+	}
+	categories := map[string]string{"/select": SOLR_CATEGORY_QUERY_HANDLER, "updateHandler": SOLR_CATEGORY_UPDATE_HANDLER, "filterCache": SOLR_CATEGORY_CACHE}
+	for block, category := range categories {
+		if data[block].GetCategory() != category {
+			t.Errorf("Category of %s is %q, want %q", block, data[block].GetCategory(), category)
+		}
+	}
+
+	//registry of the core is known, so other cores of the node are not downloaded
+	if _, err := ds.QueryData(); err != nil {
+		t.Fatal(err)
+	}
+	want := "wt=json&compact=true&registry=solr.jvm&registry=solr.node&registry=solr.jetty&registry=solr.core.films"
+	if len(queries) != 2 || queries[1] != want {
+		t.Errorf("Metrics API queries are %q, second one should be %q", queries, want)
+	}
+}
+
+func TestQueryMetricsApiDataSolrCloud(t *testing.T) {
+	queries := make([]string, 0)
+	server := metricsApiServer(t, &queries)
+	defer server.Close()
+
+	host := &SolrHostConfig{Name: "solr1", SolrUrl: strings.TrimPrefix(server.URL, "http://") + "/solr/", SolrApi: SOLR_API_METRICS}
+	host.Validate()
+	ds := NewMetricsDataSource(host, "books_shard1_replica_n1")
+	for i := 0; i < 2; i++ {
+		data, err := ds.QueryData()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if value := data["/select"].GetValue("requests"); value != 1 {
+			t.Errorf("Query %d: /select/requests = %v, want 1", i, value)
+		}
+	}
+	if !strings.HasSuffix(queries[1], "&registry=solr.core.books.shard1.replica_n1") {
+		t.Errorf("Second query %q should request only registry of the core", queries[1])
+	}
+
+	//registry, found before, is not returned any more, so all registries are read again
+	ds.coreRegistry = "solr.core.renamed"
+	queries = queries[:0]
+	if _, err := ds.QueryData(); err != nil {
+		t.Fatal(err)
+	}
+	if len(queries) != 2 || strings.Contains(queries[1], "registry=") || ds.coreRegistry != "solr.core.books.shard1.replica_n1" {
+		t.Errorf("Renamed registry should be searched again, queries %q, registry %q", queries, ds.coreRegistry)
+	}
+}
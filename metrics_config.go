@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+)
+
+const (
+	METRICA_TYPE_PLAIN       = "plain"       //last value is reported
+	METRICA_TYPE_INCREMENTAL = "incremental" //difference between last and previous values is reported
+)
+
+//Metrica definitions file. Example:
+//	{
+//		"metrics": [
+//			{"name": "handler/errors/select", "units": "errors/seconds", "stat_block": "/select", "key": "errors", "type": "incremental"},
+//			{"name": "handler/cache/size/filterCache", "units": "items", "stat_block": "filterCache", "key": "size", "type": "plain"}
+//		]
+//	}
+type MetricasConfig struct {
+	Metricas []*MetricaDefinition `json:"metrics"`
+}
+
+type MetricaDefinition struct {
+	Name               string `json:"name"`
+	Units              string `json:"units"`
+	StatBlockKey       string `json:"stat_block"`
+	KeyInsideStatBlock string `json:"key"`
+	Type               string `json:"type"`
+}
+
+//Load plain and incremental metricas from definitions file
+func LoadMetricas(fileName string) ([]*Metrica, []*Metrica, error) {
+	content, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	config := &MetricasConfig{}
+	if err := json.Unmarshal(content, config); err != nil {
+		return nil, nil, fmt.Errorf("Can not parse metrics file %s: %v\n", fileName, err)
+	}
+	if err := config.Validate(); err != nil {
+		return nil, nil, err
+	}
+
+	plain := make([]*Metrica, 0, len(config.Metricas))
+	incremental := make([]*Metrica, 0, len(config.Metricas))
+	for _, definition := range config.Metricas {
+		metrica := &Metrica{
+			DataKey: &MetricaDataKey{
+				StatBlockKey:       definition.StatBlockKey,
+				KeyInsideStatBlock: definition.KeyInsideStatBlock,
+			},
+			Name:  definition.Name,
+			Units: definition.Units,
+		}
+		if definition.Type == METRICA_TYPE_INCREMENTAL {
+			incremental = append(incremental, metrica)
+		} else {
+			plain = append(plain, metrica)
+		}
+	}
+	return plain, incremental, nil
+}
+
+func (config *MetricasConfig) Validate() error {
+	if len(config.Metricas) == 0 {
+		return fmt.Errorf("No metrics defined\n")
+	}
+
+	names := make(map[string]bool, len(config.Metricas))
+	for i, definition := range config.Metricas {
+		if definition == nil {
+			return fmt.Errorf("Metric #%d is empty\n", i+1)
+		}
+		if definition.Name == "" {
+			return fmt.Errorf("Metric #%d: name is required\n", i+1)
+		}
+		if definition.Units == "" || definition.StatBlockKey == "" || definition.KeyInsideStatBlock == "" {
+			return fmt.Errorf("Metric %s: units, stat_block and key are required\n", definition.Name)
+		}
+		if definition.Type == "" {
+			definition.Type = METRICA_TYPE_PLAIN
+		}
+		if definition.Type != METRICA_TYPE_PLAIN && definition.Type != METRICA_TYPE_INCREMENTAL {
+			return fmt.Errorf("Metric %s: unknown type %s\n", definition.Name, definition.Type)
+		}
+		if names[definition.Name] {
+			return fmt.Errorf("Metric %s is defined several times\n", definition.Name)
+		}
+		names[definition.Name] = true
+	}
+	return nil
+}
+
+//Convert metricas to definitions file format, used to get editable copy of built-in metricas
+func DumpMetricas(plain []*Metrica, incremental []*Metrica) ([]byte, error) {
+	config := &MetricasConfig{Metricas: make([]*MetricaDefinition, 0, len(plain)+len(incremental))}
+	for _, metrica := range plain {
+		config.Metricas = append(config.Metricas, newMetricaDefinition(metrica, METRICA_TYPE_PLAIN))
+	}
+	for _, metrica := range incremental {
+		config.Metricas = append(config.Metricas, newMetricaDefinition(metrica, METRICA_TYPE_INCREMENTAL))
+	}
+	return json.MarshalIndent(config, "", "    ")
+}
+
+func newMetricaDefinition(metrica *Metrica, metricaType string) *MetricaDefinition {
+	return &MetricaDefinition{
+		Name:               metrica.Name,
+		Units:              metrica.Units,
+		StatBlockKey:       metrica.DataKey.StatBlockKey,
+		KeyInsideStatBlock: metrica.DataKey.KeyInsideStatBlock,
+		Type:               metricaType,
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	COMMAND_NAGIOS = "nagios"
+
+	NAGIOS_OK       = 0
+	NAGIOS_WARNING  = 1
+	NAGIOS_CRITICAL = 2
+	NAGIOS_UNKNOWN  = 3
+
+	NAGIOS_THRESHOLD_SEPARATOR = ";"
+)
+
+var nagiosStatusNames = map[int]string{
+	NAGIOS_OK:       "OK",
+	NAGIOS_WARNING:  "WARNING",
+	NAGIOS_CRITICAL: "CRITICAL",
+	NAGIOS_UNKNOWN:  "UNKNOWN",
+}
+
+//Severity of statuses: critical alert is more important than failed check of another metrica
+var nagiosStatusSeverity = map[int]int{
+	NAGIOS_OK:       0,
+	NAGIOS_WARNING:  1,
+	NAGIOS_UNKNOWN:  2,
+	NAGIOS_CRITICAL: 3,
+}
+
+func worseNagiosStatus(status int, other int) int {
+	if nagiosStatusSeverity[other] > nagiosStatusSeverity[status] {
+		return other
+	}
+	return status
+}
+
+//Units of metricas, which have standard unit of measurement in performance data
+var nagiosUnits = map[string]string{
+	"bytes":   "B",
+	"percent": "%",
+}
+
+//Threshold range in Nagios plugin format: "10" alerts outside of 0..10, "10:" below 10,
+//"~:10" above 10, "10:20" outside of 10..20 and "@10:20" inside of 10..20
+type NagiosRange struct {
+	Definition string
+	Start      float64
+	End        float64
+	Inside     bool
+}
+
+func NewNagiosRange(definition string) (*NagiosRange, error) {
+	nagiosRange := &NagiosRange{Definition: definition, Start: 0, End: math.Inf(1)}
+	rangeValue := definition
+	if strings.HasPrefix(rangeValue, "@") {
+		nagiosRange.Inside = true
+		rangeValue = strings.TrimPrefix(rangeValue, "@")
+	}
+	if rangeValue == "" {
+		return nil, fmt.Errorf("Invalid threshold range %s\n", definition)
+	}
+
+	start, end := "", rangeValue
+	if parts := strings.SplitN(rangeValue, ":", 2); len(parts) == 2 {
+		start, end = parts[0], parts[1]
+	}
+
+	var err error
+	if start == "~" {
+		nagiosRange.Start = math.Inf(-1)
+	} else if start != "" {
+		if nagiosRange.Start, err = strconv.ParseFloat(start, 64); err != nil {
+			return nil, fmt.Errorf("Invalid threshold range %s\n", definition)
+		}
+	}
+	if end != "" {
+		if nagiosRange.End, err = strconv.ParseFloat(end, 64); err != nil {
+			return nil, fmt.Errorf("Invalid threshold range %s\n", definition)
+		}
+	}
+	if nagiosRange.Start > nagiosRange.End {
+		return nil, fmt.Errorf("Invalid threshold range %s: start is greater than end\n", definition)
+	}
+	return nagiosRange, nil
+}
+
+//Value should raise alert
+func (nagiosRange *NagiosRange) Alert(value float64) bool {
+	inside := value >= nagiosRange.Start && value <= nagiosRange.End
+	return inside == nagiosRange.Inside
+}
+
+//Thresholds of one metrica, defined as "metrica name;warning range;critical range".
+//Any of ranges can be empty, then metrica is only reported in performance data
+type NagiosThreshold struct {
+	MetricaName string
+	Warning     *NagiosRange
+	Critical    *NagiosRange
+}
+
+func NewNagiosThreshold(definition string) (*NagiosThreshold, error) {
+	parts := strings.Split(definition, NAGIOS_THRESHOLD_SEPARATOR)
+	if len(parts) > 3 || strings.TrimSpace(parts[0]) == "" {
+		return nil, fmt.Errorf("Invalid threshold %s, should be like handler/errors/standard;5;10\n", definition)
+	}
+
+	threshold := &NagiosThreshold{MetricaName: strings.TrimSpace(parts[0])}
+	var err error
+	if len(parts) > 1 && parts[1] != "" {
+		if threshold.Warning, err = NewNagiosRange(strings.TrimSpace(parts[1])); err != nil {
+			return nil, err
+		}
+	}
+	if len(parts) > 2 && parts[2] != "" {
+		if threshold.Critical, err = NewNagiosRange(strings.TrimSpace(parts[2])); err != nil {
+			return nil, err
+		}
+	}
+	return threshold, nil
+}
+
+func (threshold *NagiosThreshold) Status(value float64) int {
+	if threshold.Critical != nil && threshold.Critical.Alert(value) {
+		return NAGIOS_CRITICAL
+	}
+	if threshold.Warning != nil && threshold.Warning.Alert(value) {
+		return NAGIOS_WARNING
+	}
+	return NAGIOS_OK
+}
+
+//Performance data in label=value[UOM];warn;crit format
+func (threshold *NagiosThreshold) PerfData(label string, value float64, units string) string {
+	warning, critical := "", ""
+	if threshold.Warning != nil {
+		warning = threshold.Warning.Definition
+	}
+	if threshold.Critical != nil {
+		critical = threshold.Critical.Definition
+	}
+	return fmt.Sprintf("'%s'=%s%s;%s;%s", strings.Replace(label, "'", "''", -1), formatCheckValue(value), nagiosUnits[units], warning, critical)
+}
+
+func NewNagiosThresholds(definitions []string) ([]*NagiosThreshold, error) {
+	thresholds := make([]*NagiosThreshold, 0, len(definitions))
+	for _, definition := range definitions {
+		threshold, err := NewNagiosThreshold(definition)
+		if err != nil {
+			return nil, err
+		}
+		thresholds = append(thresholds, threshold)
+	}
+	return thresholds, nil
+}
+
+//Query all hosts and cores twice, evaluate thresholds and print Nagios plugin output:
+//status line with alerts and performance data of all thresholded metricas.
+//Incremental metricas are compared by their difference between queries.
+//Returns Nagios exit code, UNKNOWN when Solr can not be queried or metrica has no value,
+//unless other metrica is critical
+func RunNagiosCheck(config *AgentConfig, thresholds []*NagiosThreshold, interval int, out io.Writer) int {
+	components, errors := newCheckComponents(config)
+	components, queryErrors := checkQueryTwice(components, interval)
+	errors = append(errors, queryErrors...)
+
+	status := NAGIOS_OK
+	messages := make([]string, 0)
+	for _, err := range errors {
+		messages = append(messages, strings.TrimSpace(err.Error()))
+		status = NAGIOS_UNKNOWN
+	}
+
+	perfData := make([]string, 0)
+	for _, threshold := range thresholds {
+		for _, component := range components {
+			label := threshold.MetricaName
+			if len(components) > 1 {
+				label = component.Name + "/" + label
+			}
+
+			sample, err := nagiosSample(component, threshold.MetricaName)
+			if err != nil {
+				messages = append(messages, fmt.Sprintf("%s: %s", label, strings.TrimSpace(err.Error())))
+				status = worseNagiosStatus(status, NAGIOS_UNKNOWN)
+				continue
+			}
+
+			perfData = append(perfData, threshold.PerfData(label, sample.Value, sample.Units))
+			metricaStatus := threshold.Status(sample.Value)
+			if metricaStatus == NAGIOS_OK {
+				continue
+			}
+			messages = append(messages, fmt.Sprintf("%s=%s %s", label, formatCheckValue(sample.Value), nagiosStatusNames[metricaStatus]))
+			status = worseNagiosStatus(status, metricaStatus)
+		}
+	}
+
+	if len(messages) == 0 {
+		messages = append(messages, fmt.Sprintf("%d metrics checked on %d Solr hosts and cores", len(perfData), len(components)))
+	}
+	fmt.Fprintf(out, "SOLR %s - %s", nagiosStatusNames[status], strings.Join(messages, ", "))
+	if len(perfData) > 0 {
+		fmt.Fprintf(out, " | %s", strings.Join(perfData, " "))
+	}
+	fmt.Fprintln(out)
+	return status
+}
+
+func nagiosSample(component *SolrComponent, name string) (*MetricaSample, error) {
+	for _, metrica := range component.Metricas {
+		if metrica.GetName() == name {
+			return newMetricaSample(component, metrica)
+		}
+	}
+	return nil, fmt.Errorf("unknown metric")
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestNewNagiosRange(t *testing.T) {
+	tests := []struct {
+		definition string
+		start      float64
+		end        float64
+		inside     bool
+	}{
+		{"10", 0, 10, false},
+		{"10:", 10, math.Inf(1), false},
+		{"~:10", math.Inf(-1), 10, false},
+		{"10:20", 10, 20, false},
+		{"@10:20", 10, 20, true},
+		{"-5:-1.5", -5, -1.5, false},
+		{"@~:0", math.Inf(-1), 0, true},
+	}
+	for _, test := range tests {
+		nagiosRange, err := NewNagiosRange(test.definition)
+		if err != nil {
+			t.Errorf("NewNagiosRange(%q) failed: %v", test.definition, err)
+			continue
+		}
+		if nagiosRange.Start != test.start || nagiosRange.End != test.end || nagiosRange.Inside != test.inside {
+			t.Errorf("NewNagiosRange(%q) = %v..%v inside %v, want %v..%v inside %v", test.definition,
+				nagiosRange.Start, nagiosRange.End, nagiosRange.Inside, test.start, test.end, test.inside)
+		}
+	}
+}
+
+func TestNewNagiosRangeInvalid(t *testing.T) {
+	for _, definition := range []string{"", "abc", "10:abc", "~", "20:10", "@", "1:2:3", "10:~"} {
+		if _, err := NewNagiosRange(definition); err == nil {
+			t.Errorf("NewNagiosRange(%q) should fail", definition)
+		}
+	}
+}
+
+func TestNagiosRangeAlert(t *testing.T) {
+	tests := []struct {
+		definition string
+		value      float64
+		alert      bool
+	}{
+		{"10", -1, true},
+		{"10", 0, false},
+		{"10", 10, false},
+		{"10", 10.5, true},
+		{"10:", 9, true},
+		{"10:", 10, false},
+		{"10:", 1e9, false},
+		{"~:10", -1e9, false},
+		{"~:10", 11, true},
+		{"10:20", 9.99, true},
+		{"10:20", 15, false},
+		{"10:20", 21, true},
+		{"@10:20", 9, false},
+		{"@10:20", 10, true},
+		{"@10:20", 20, true},
+		{"@10:20", 21, false},
+	}
+	for _, test := range tests {
+		nagiosRange, err := NewNagiosRange(test.definition)
+		if err != nil {
+			t.Fatalf("NewNagiosRange(%q) failed: %v", test.definition, err)
+		}
+		if alert := nagiosRange.Alert(test.value); alert != test.alert {
+			t.Errorf("Range %q alert for %v is %v, want %v", test.definition, test.value, alert, test.alert)
+		}
+	}
+}
+
+func TestNewNagiosThreshold(t *testing.T) {
+	tests := []struct {
+		definition string
+		name       string
+		warning    string
+		critical   string
+	}{
+		{"handler/errors/standard;5;10", "handler/errors/standard", "5", "10"},
+		{" handler/errors/standard ; 5 ; @10:20 ", "handler/errors/standard", "5", "@10:20"},
+		{"solr/restarts", "solr/restarts", "", ""},
+		{"solr/restarts;;1", "solr/restarts", "", "1"},
+		{"solr/restarts;1", "solr/restarts", "1", ""},
+	}
+	for _, test := range tests {
+		threshold, err := NewNagiosThreshold(test.definition)
+		if err != nil {
+			t.Errorf("NewNagiosThreshold(%q) failed: %v", test.definition, err)
+			continue
+		}
+		warning, critical := "", ""
+		if threshold.Warning != nil {
+			warning = threshold.Warning.Definition
+		}
+		if threshold.Critical != nil {
+			critical = threshold.Critical.Definition
+		}
+		if threshold.MetricaName != test.name || warning != test.warning || critical != test.critical {
+			t.Errorf("NewNagiosThreshold(%q) = %q;%q;%q, want %q;%q;%q", test.definition,
+				threshold.MetricaName, warning, critical, test.name, test.warning, test.critical)
+		}
+	}
+
+	for _, definition := range []string{"", " ;5;10", "solr/restarts;5;10;20", "solr/restarts;abc", "solr/restarts;5;20:10"} {
+		if _, err := NewNagiosThreshold(definition); err == nil {
+			t.Errorf("NewNagiosThreshold(%q) should fail", definition)
+		}
+	}
+}
+
+func TestNagiosThresholdStatus(t *testing.T) {
+	threshold, err := NewNagiosThreshold("handler/errors/standard;5;10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		value  float64
+		status int
+	}{
+		{0, NAGIOS_OK},
+		{5, NAGIOS_OK},
+		{6, NAGIOS_WARNING},
+		{10, NAGIOS_WARNING},
+		{11, NAGIOS_CRITICAL},
+		{-1, NAGIOS_CRITICAL},
+	}
+	for _, test := range tests {
+		if status := threshold.Status(test.value); status != test.status {
+			t.Errorf("Status(%v) = %d, want %d", test.value, status, test.status)
+		}
+	}
+	if perfData := threshold.PerfData("it's used", 1024, "bytes"); perfData != "'it''s used'=1024B;5;10" {
+		t.Errorf("PerfData = %q", perfData)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"github.com/yvasiyarov/newrelic_platform_go"
+	"sort"
+)
+
+//Sends metricas to newrelic platform, one newrelic component per Solr host or core
+type NewrelicSink struct {
+	Plugin *newrelic_platform_go.NewrelicPlugin
+}
+
+func NewNewrelicSink(license string, pollInterval int, verbose bool) *NewrelicSink {
+	plugin := newrelic_platform_go.NewNewrelicPlugin(AGENT_VERSION, license, pollInterval)
+	plugin.Verbose = verbose
+	return &NewrelicSink{Plugin: plugin}
+}
+
+func (sink *NewrelicSink) GetName() string {
+	return "newrelic"
+}
+
+//Metrica with value, already read from Solr
+type sampleMetrica struct {
+	Sample *MetricaSample
+}
+
+func (metrica *sampleMetrica) GetName() string {
+	return metrica.Sample.Name
+}
+func (metrica *sampleMetrica) GetUnits() string {
+	return metrica.Sample.Units
+}
+func (metrica *sampleMetrica) GetValue() (float64, error) {
+	return metrica.Sample.Value, nil
+}
+
+func (sink *NewrelicSink) Send(batch []*MetricaSample) error {
+	components := make(map[string]*newrelic_platform_go.PluginComponent)
+	names := make([]string, 0)
+	for _, sample := range batch {
+		component, ok := components[sample.Component]
+		if !ok {
+			component = newrelic_platform_go.NewPluginComponent(sample.Component, AGENT_GUID)
+			components[sample.Component] = component
+			names = append(names, sample.Component)
+		}
+		component.AddMetrica(&sampleMetrica{Sample: sample})
+	}
+
+	sort.Strings(names)
+	sink.Plugin.ComponentModels = make([]newrelic_platform_go.IComponent, 0, len(names))
+	for _, name := range names {
+		sink.Plugin.AddComponent(components[name])
+	}
+	return sink.Plugin.Harvest()
+}
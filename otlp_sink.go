@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	OTLP_METRICS_PATH  = "/v1/metrics"
+	OTLP_HTTP_TIMEOUT  = 10 //seconds
+	OTLP_SERVICE_NAME  = "solr"
+	OTLP_SCOPE_NAME    = "github.com/yvasiyarov/newrelic_solr"
+	OTLP_METRIC_PREFIX = "solr."
+
+	//AGGREGATION_TEMPORALITY_CUMULATIVE in OTLP protocol
+	OTLP_TEMPORALITY_CUMULATIVE = 2
+)
+
+var otlpInvalidChars = regexp.MustCompile("[^a-zA-Z0-9_.-]+")
+
+//Exports metricas with OTLP/HTTP JSON encoding, one resource per Solr host or core.
+//Plain metricas are exported as gauges, incremental ones as monotonic cumulative sums with raw counter values
+type OtlpSink struct {
+	Endpoint string
+
+	client *http.Client
+}
+
+// Set of structures used to build OTLP JSON request, see opentelemetry-proto metrics.proto
+type OtlpMetricsRequest struct {
+	ResourceMetrics []*OtlpResourceMetrics `json:"resourceMetrics"`
+}
+type OtlpResourceMetrics struct {
+	Resource     OtlpResource        `json:"resource"`
+	ScopeMetrics []*OtlpScopeMetrics `json:"scopeMetrics"`
+}
+type OtlpResource struct {
+	Attributes []OtlpAttribute `json:"attributes"`
+}
+type OtlpScopeMetrics struct {
+	Scope   OtlpScope     `json:"scope"`
+	Metrics []*OtlpMetric `json:"metrics"`
+}
+type OtlpScope struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+type OtlpMetric struct {
+	Name  string     `json:"name"`
+	Unit  string     `json:"unit,omitempty"`
+	Gauge *OtlpGauge `json:"gauge,omitempty"`
+	Sum   *OtlpSum   `json:"sum,omitempty"`
+}
+type OtlpGauge struct {
+	DataPoints []*OtlpDataPoint `json:"dataPoints"`
+}
+type OtlpSum struct {
+	DataPoints             []*OtlpDataPoint `json:"dataPoints"`
+	AggregationTemporality int              `json:"aggregationTemporality"`
+	IsMonotonic            bool             `json:"isMonotonic"`
+}
+type OtlpDataPoint struct {
+	Attributes        []OtlpAttribute `json:"attributes,omitempty"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano,omitempty"`
+	TimeUnixNano      string          `json:"timeUnixNano"`
+	AsDouble          float64         `json:"asDouble"`
+}
+type OtlpAttribute struct {
+	Key   string             `json:"key"`
+	Value OtlpAttributeValue `json:"value"`
+}
+type OtlpAttributeValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+//Endpoint is OTLP receiver url like http://127.0.0.1:4318, /v1/metrics path is added when it is missing
+func NewOtlpSink(endpoint string) *OtlpSink {
+	if !strings.HasPrefix(endpoint, "http://") && !strings.HasPrefix(endpoint, "https://") {
+		endpoint = "http://" + endpoint
+	}
+	endpoint = strings.TrimRight(endpoint, "/")
+	if !strings.HasSuffix(endpoint, OTLP_METRICS_PATH) {
+		endpoint += OTLP_METRICS_PATH
+	}
+	return &OtlpSink{
+		Endpoint: endpoint,
+		client:   &http.Client{Timeout: OTLP_HTTP_TIMEOUT * time.Second},
+	}
+}
+
+func (sink *OtlpSink) GetName() string {
+	return "otlp"
+}
+
+func (sink *OtlpSink) Send(batch []*MetricaSample) error {
+	request := newOtlpMetricsRequest(batch)
+	if len(request.ResourceMetrics) == 0 {
+		return nil
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	response, err := sink.client.Post(sink.Endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode/100 != 2 {
+		responseBody, _ := ioutil.ReadAll(response.Body)
+		return fmt.Errorf("OTLP receiver returned %s: %s\n", response.Status, strings.TrimSpace(string(responseBody)))
+	}
+	return nil
+}
+
+func newOtlpMetricsRequest(batch []*MetricaSample) *OtlpMetricsRequest {
+	resources := make(map[string]*OtlpResourceMetrics)
+	metrics := make(map[string]*OtlpMetric)
+	components := make([]string, 0)
+	for _, sample := range batch {
+		if math.IsNaN(sample.RawValue) || math.IsInf(sample.RawValue, 0) {
+			continue
+		}
+
+		resource, ok := resources[sample.Component]
+		if !ok {
+			resource = newOtlpResourceMetrics(sample)
+			resources[sample.Component] = resource
+			components = append(components, sample.Component)
+		}
+		scope := resource.ScopeMetrics[0]
+
+		handler := sample.HandlerName()
+		name := otlpMetricName(sample.Name, handler)
+		metric, ok := metrics[sample.Component+" "+name]
+		if !ok {
+			metric = &OtlpMetric{Name: name, Unit: sample.Units}
+			if sample.Incremental {
+				metric.Sum = &OtlpSum{AggregationTemporality: OTLP_TEMPORALITY_CUMULATIVE, IsMonotonic: true}
+			} else {
+				metric.Gauge = &OtlpGauge{}
+			}
+			metrics[sample.Component+" "+name] = metric
+			scope.Metrics = append(scope.Metrics, metric)
+		}
+
+		timestamp := sample.Timestamp
+		if timestamp.IsZero() {
+			timestamp = time.Now()
+		}
+		point := &OtlpDataPoint{
+			TimeUnixNano: strconv.FormatInt(timestamp.UnixNano(), 10),
+			AsDouble:     sample.RawValue,
+		}
+		if handler != "" {
+			point.Attributes = []OtlpAttribute{otlpAttribute("solr.handler", handler)}
+		}
+		if metric.Sum != nil {
+			if !sample.StartTime.IsZero() {
+				point.StartTimeUnixNano = strconv.FormatInt(sample.StartTime.UnixNano(), 10)
+			}
+			metric.Sum.DataPoints = append(metric.Sum.DataPoints, point)
+		} else {
+			metric.Gauge.DataPoints = append(metric.Gauge.DataPoints, point)
+		}
+	}
+
+	sort.Strings(components)
+	request := &OtlpMetricsRequest{ResourceMetrics: make([]*OtlpResourceMetrics, 0, len(components))}
+	for _, component := range components {
+		request.ResourceMetrics = append(request.ResourceMetrics, resources[component])
+	}
+	return request
+}
+
+func newOtlpResourceMetrics(sample *MetricaSample) *OtlpResourceMetrics {
+	attributes := []OtlpAttribute{
+		otlpAttribute("service.name", OTLP_SERVICE_NAME),
+		otlpAttribute("service.instance.id", sample.Component),
+		otlpAttribute("solr.host", sample.Host),
+	}
+	if sample.Core != "" {
+		attributes = append(attributes, otlpAttribute("solr.core", sample.Core))
+	}
+	if sample.SolrVersion != "" {
+		attributes = append(attributes, otlpAttribute("service.version", sample.SolrVersion))
+	}
+	return &OtlpResourceMetrics{
+		Resource: OtlpResource{Attributes: attributes},
+		ScopeMetrics: []*OtlpScopeMetrics{
+			&OtlpScopeMetrics{
+				Scope:   OtlpScope{Name: OTLP_SCOPE_NAME, Version: AGENT_VERSION},
+				Metrics: make([]*OtlpMetric, 0),
+			},
+		},
+	}
+}
+
+func otlpAttribute(key string, value string) OtlpAttribute {
+	return OtlpAttribute{Key: key, Value: OtlpAttributeValue{StringValue: value}}
+}
+
+//Dotted metric name without handler segments, handler is passed as data point attribute:
+//handler/errors/standard becomes solr.handler.errors with solr.handler=standard
+func otlpMetricName(name string, handler string) string {
+	segments := make([]string, 0)
+	for _, part := range metricaNameSegments(name, handler) {
+		segments = append(segments, strings.Trim(otlpInvalidChars.ReplaceAllString(part, "_"), "_."))
+	}
+	metricName := strings.Join(segments, ".")
+	if !strings.HasPrefix(metricName, OTLP_METRIC_PREFIX) {
+		metricName = OTLP_METRIC_PREFIX + metricName
+	}
+	return metricName
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestOtlpMetricName(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler string
+		metric  string
+	}{
+		{"handler/errors/standard", "standard", "solr.handler.errors"},
+		{"handler/requests//select", "select", "solr.handler.requests"},
+		{"handler/requests/update/json", "update/json", "solr.handler.requests"},
+		{"handler/time_per_request//admin/ping", "admin/ping", "solr.handler.time_per_request"},
+		{"handler/errors/update/json/per_minute", "update/json", "solr.handler.errors.per_minute"},
+		{"handler/cache/filterCache/hit_ratio", "filterCache", "solr.handler.cache.hit_ratio"},
+		{"handler/requests/update/json", "", "solr.handler.requests.update.json"},
+		{"solr/memory/jvm/used", "", "solr.memory.jvm.used"},
+		{"core/index/num docs", "", "solr.core.index.num_docs"},
+	}
+	for _, test := range tests {
+		if metric := otlpMetricName(test.name, test.handler); metric != test.metric {
+			t.Errorf("otlpMetricName(%q, %q) = %q, want %q", test.name, test.handler, metric, test.metric)
+		}
+	}
+}
+
+func TestOtlpSink(t *testing.T) {
+	var body, contentType, path string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		body = string(data)
+		contentType = r.Header.Get("Content-Type")
+		path = r.URL.Path
+	}))
+	defer server.Close()
+
+	timestamp := time.Unix(100, 0)
+	startTime := time.Unix(50, 0)
+	batch := []*MetricaSample{
+		{Component: "solr1/products", Host: "solr1", Core: "products", SolrVersion: "8.11.2", Name: "handler/errors/standard", StatBlock: "standard", Units: "errors", RawValue: 10, Value: 2, Incremental: true, Timestamp: timestamp, StartTime: startTime},
+		{Component: "solr1/products", Host: "solr1", Core: "products", SolrVersion: "8.11.2", Name: "handler/errors/update/json", StatBlock: "/update/json", Units: "errors", RawValue: 1, Value: 1, Incremental: true, Timestamp: timestamp, StartTime: startTime},
+		{Component: "solr1", Host: "solr1", Name: "solr/memory/jvm/used", StatBlock: "solr", Key: "jvm_memory_used", Units: "bytes", RawValue: 1024, Timestamp: timestamp},
+	}
+	if err := NewOtlpSink(server.URL).Send(batch); err != nil {
+		t.Fatal(err)
+	}
+
+	if path != OTLP_METRICS_PATH {
+		t.Errorf("OTLP receiver got path %q, want %q", path, OTLP_METRICS_PATH)
+	}
+	if contentType != "application/json" {
+		t.Errorf("OTLP receiver got content type %q, want application/json", contentType)
+	}
+	want := `{"resourceMetrics":[` +
+		`{"resource":{"attributes":[` +
+		`{"key":"service.name","value":{"stringValue":"solr"}},` +
+		`{"key":"service.instance.id","value":{"stringValue":"solr1"}},` +
+		`{"key":"solr.host","value":{"stringValue":"solr1"}}]},` +
+		`"scopeMetrics":[{"scope":{"name":"github.com/yvasiyarov/newrelic_solr","version":"` + AGENT_VERSION + `"},"metrics":[` +
+		`{"name":"solr.memory.jvm.used","unit":"bytes","gauge":{"dataPoints":[{"timeUnixNano":"100000000000","asDouble":1024}]}}]}]},` +
+		`{"resource":{"attributes":[` +
+		`{"key":"service.name","value":{"stringValue":"solr"}},` +
+		`{"key":"service.instance.id","value":{"stringValue":"solr1/products"}},` +
+		`{"key":"solr.host","value":{"stringValue":"solr1"}},` +
+		`{"key":"solr.core","value":{"stringValue":"products"}},` +
+		`{"key":"service.version","value":{"stringValue":"8.11.2"}}]},` +
+		`"scopeMetrics":[{"scope":{"name":"github.com/yvasiyarov/newrelic_solr","version":"` + AGENT_VERSION + `"},"metrics":[` +
+		`{"name":"solr.handler.errors","unit":"errors","sum":{"dataPoints":[` +
+		`{"attributes":[{"key":"solr.handler","value":{"stringValue":"standard"}}],"startTimeUnixNano":"50000000000","timeUnixNano":"100000000000","asDouble":10},` +
+		`{"attributes":[{"key":"solr.handler","value":{"stringValue":"update/json"}}],"startTimeUnixNano":"50000000000","timeUnixNano":"100000000000","asDouble":1}],` +
+		`"aggregationTemporality":2,"isMonotonic":true}}]}]}]}`
+	if body != want {
+		t.Errorf("OTLP receiver got\n%s\nwant\n%s", body, want)
+	}
+}
+
+func TestOtlpSinkError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unsupported content type", http.StatusUnsupportedMediaType)
+	}))
+	defer server.Close()
+
+	batch := []*MetricaSample{{Component: "solr1", Host: "solr1", Name: "solr/restarts", RawValue: 1, Timestamp: time.Unix(100, 0)}}
+	if err := NewOtlpSink(server.URL).Send(batch); err == nil {
+		t.Error("Send should fail, when OTLP receiver returns 415")
+	}
+}
+
+func TestNewOtlpSink(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		url      string
+	}{
+		{"127.0.0.1:4318", "http://127.0.0.1:4318/v1/metrics"},
+		{"http://collector:4318/", "http://collector:4318/v1/metrics"},
+		{"https://collector/v1/metrics", "https://collector/v1/metrics"},
+	}
+	for _, test := range tests {
+		if url := NewOtlpSink(test.endpoint).Endpoint; url != test.url {
+			t.Errorf("NewOtlpSink(%q).Endpoint = %q, want %q", test.endpoint, url, test.url)
+		}
+	}
+}
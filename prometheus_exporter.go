@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	PROMETHEUS_NAMESPACE    = "solr_"
+	PROMETHEUS_CONTENT_TYPE = "text/plain; version=0.0.4"
+)
+
+var prometheusInvalidChars = regexp.MustCompile("[^a-zA-Z0-9_]+")
+
+//Serves metricas of all agent components in Prometheus text exposition format.
+//Plain metricas are exported as gauges, incremental ones as counters with their raw values
+type PrometheusExporter struct {
+	Agent *SolrAgent
+}
+
+type prometheusSample struct {
+	Component string
+	Value     float64
+}
+
+type prometheusMetric struct {
+	Name    string
+	Help    string
+	Type    string
+	Samples []prometheusSample
+}
+
+func NewPrometheusExporter(agent *SolrAgent) *PrometheusExporter {
+	return &PrometheusExporter{Agent: agent}
+}
+
+func (exporter *PrometheusExporter) Register(mux *http.ServeMux) {
+	mux.Handle("/metrics", exporter)
+}
+
+func (exporter *PrometheusExporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", PROMETHEUS_CONTENT_TYPE)
+	w.Write(exporter.Collect())
+}
+
+//Read all metricas and format them
+func (exporter *PrometheusExporter) Collect() []byte {
+	metrics := make(map[string]*prometheusMetric)
+	for _, sample := range exporter.Agent.Collect() {
+		metric := newPrometheusMetric(sample)
+		if existMetric, ok := metrics[metric.Name]; ok {
+			metric = existMetric
+		} else {
+			metrics[metric.Name] = metric
+		}
+		metric.Samples = append(metric.Samples, prometheusSample{Component: sample.Component, Value: sample.RawValue})
+	}
+
+	names := make([]string, 0, len(metrics))
+	for name := range metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buffer bytes.Buffer
+	for _, name := range names {
+		metric := metrics[name]
+		fmt.Fprintf(&buffer, "# HELP %s %s\n", metric.Name, escapePrometheusHelp(metric.Help))
+		fmt.Fprintf(&buffer, "# TYPE %s %s\n", metric.Name, metric.Type)
+		for _, sample := range metric.Samples {
+			fmt.Fprintf(&buffer, "%s{component=\"%s\"} %s\n", metric.Name, escapePrometheusLabel(sample.Component), formatPrometheusValue(sample.Value))
+		}
+	}
+	return buffer.Bytes()
+}
+
+func newPrometheusMetric(sample *MetricaSample) *prometheusMetric {
+	metric := &prometheusMetric{
+		Name: prometheusMetricName(sample.Name),
+		Help: fmt.Sprintf("%s [%s]", sample.Name, sample.Units),
+		Type: "gauge",
+	}
+	if sample.Incremental {
+		metric.Name += "_total"
+		metric.Type = "counter"
+	}
+	return metric
+}
+
+//Convert slash separated metrica name to Prometheus metric name:
+//handler/cache/hitrates/filterCache becomes solr_handler_cache_hitrates_filterCache
+func prometheusMetricName(name string) string {
+	name = strings.Trim(prometheusInvalidChars.ReplaceAllString(name, "_"), "_")
+	if !strings.HasPrefix(name, PROMETHEUS_NAMESPACE) {
+		name = PROMETHEUS_NAMESPACE + name
+	}
+	return name
+}
+
+func escapePrometheusHelp(help string) string {
+	return strings.NewReplacer("\\", "\\\\", "\n", "\\n").Replace(help)
+}
+
+func escapePrometheusLabel(value string) string {
+	return strings.NewReplacer("\\", "\\\\", "\n", "\\n", "\"", "\\\"").Replace(value)
+}
+
+func formatPrometheusValue(value float64) string {
+	switch {
+	case math.IsNaN(value):
+		return "NaN"
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+//Value of one metrica of Solr host or core
+type MetricaSample struct {
+	Component   string
+	Host        string
+	Core        string
+	Name        string
+	StatBlock   string //block of Solr statistics, like handler or cache name
+	Key         string //key inside stat block
+	Units       string
+	Value       float64 //reported value: last value or difference with previous one for incremental metricas
+	RawValue    float64 //last value, read from Solr
+	PrevValue   float64 //value, read from Solr on previous query, or sent on previous interval for incremental metricas
+	Incremental bool
+	Timestamp   time.Time
+	StartTime   time.Time //incremental metricas are accumulated since this time
+	SolrVersion string
+}
+
+//Name of handler or cache, which metrica belongs to. Empty for metricas of whole Solr or core
+func (sample *MetricaSample) HandlerName() string {
+	if !strings.HasPrefix(sample.Name, "handler/") {
+		return ""
+	}
+	return strings.Trim(sample.StatBlock, "/")
+}
+
+//Segments of metrica name without segments of handler name, which can contain slashes itself:
+//handler/requests//update/json without update/json handler is handler, requests
+func metricaNameSegments(name string, handler string) []string {
+	segments := nonEmptySegments(name)
+	handlerSegments := nonEmptySegments(handler)
+	if len(handlerSegments) == 0 {
+		return segments
+	}
+	for i := len(segments) - len(handlerSegments); i >= 0; i-- {
+		if strings.Join(segments[i:i+len(handlerSegments)], "/") == strings.Join(handlerSegments, "/") {
+			return append(segments[:i:i], segments[i+len(handlerSegments):]...)
+		}
+	}
+	return segments
+}
+
+func nonEmptySegments(path string) []string {
+	segments := make([]string, 0)
+	for _, segment := range strings.Split(path, "/") {
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	return segments
+}
+
+//Output, which receives values of all metricas every interval
+type ISink interface {
+	GetName() string
+	Send(batch []*MetricaSample) error
+}
+
+//Sink, which keeps failed batch and resends it itself. Counters of such batch are sent,
+//even when Send returned error, so they are not included into the next batch
+type IBufferedSink interface {
+	Buffered() bool
+}
+
+type SinkRunner struct {
+	Sink     ISink
+	Interval int
+
+	//diagnostics of the last send, shown on status page
+	LastSendTime  time.Time
+	LastError     error
+	LastErrorTime time.Time
+	Sends         int
+	Errors        int
+	mutex         sync.Mutex
+
+	//values of incremental metricas on previous send, so every increment is sent once,
+	//even when sink interval differs from poll interval
+	sentCounters map[string]*sentCounter
+}
+
+type sentCounter struct {
+	RawValue  float64
+	StartTime time.Time
+}
+
+//Send metricas to sink every interval. Failed batch is logged and skipped, its counter increments
+//are included into the next batch, unless sink keeps failed batch itself
+func (runner *SinkRunner) Run(agent *SolrAgent) {
+	tickerChannel := time.Tick(time.Duration(runner.Interval) * time.Second)
+	for {
+		runner.send(agent.Collect())
+
+		<-tickerChannel
+	}
+}
+
+//Differences of counters are moved forward only when sink accepted the batch,
+//otherwise increments of failed batch are sent with the next one
+func (runner *SinkRunner) send(batch []*MetricaSample) error {
+	batch = runner.counterDeltas(batch)
+	err := runner.Sink.Send(batch)
+	if err != nil {
+		log.Printf("Can not send metricas to %s: %v\n", runner.Sink.GetName(), err)
+	}
+	if bufferedSink, ok := runner.Sink.(IBufferedSink); err == nil || (ok && bufferedSink.Buffered()) {
+		runner.updateSentCounters(batch)
+	}
+	runner.recordSend(err)
+	return err
+}
+
+//Incremental metricas are sent as difference with value on previous send of this sink, not with previous poll.
+//After Solr restart counter starts from zero, so all its value is the difference.
+//Metrica, which was not sent yet, keeps difference between two last polls
+func (runner *SinkRunner) counterDeltas(batch []*MetricaSample) []*MetricaSample {
+	for _, sample := range batch {
+		if !sample.Incremental {
+			continue
+		}
+		sent, ok := runner.sentCounters[sample.Component+" "+sample.Name]
+		if !ok {
+			continue
+		}
+
+		sample.PrevValue = sent.RawValue
+		if sample.RawValue < sent.RawValue || !sample.StartTime.Equal(sent.StartTime) {
+			sample.Value = sample.RawValue
+		} else {
+			sample.Value = sample.RawValue - sent.RawValue
+		}
+	}
+	return batch
+}
+
+func (runner *SinkRunner) updateSentCounters(batch []*MetricaSample) {
+	if runner.sentCounters == nil {
+		runner.sentCounters = make(map[string]*sentCounter)
+	}
+	for _, sample := range batch {
+		if sample.Incremental {
+			runner.sentCounters[sample.Component+" "+sample.Name] = &sentCounter{RawValue: sample.RawValue, StartTime: sample.StartTime}
+		}
+	}
+}
+
+func (runner *SinkRunner) recordSend(err error) {
+	runner.mutex.Lock()
+	defer runner.mutex.Unlock()
+
+	runner.Sends++
+	runner.LastSendTime = time.Now()
+	if err != nil {
+		runner.Errors++
+		runner.LastError = err
+		runner.LastErrorTime = runner.LastSendTime
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+type testSink struct {
+	Fail     bool
+	Buffer   bool
+	Received []*MetricaSample
+}
+
+func (sink *testSink) GetName() string {
+	return "test"
+}
+
+func (sink *testSink) Send(batch []*MetricaSample) error {
+	sink.Received = batch
+	if sink.Fail {
+		return fmt.Errorf("sink is not available\n")
+	}
+	return nil
+}
+
+type testBufferedSink struct {
+	testSink
+}
+
+func (sink *testBufferedSink) Buffered() bool {
+	return true
+}
+
+func TestSinkRunnerCounterDeltas(t *testing.T) {
+	startTime := time.Unix(100, 0)
+	restartTime := time.Unix(500, 0)
+	tests := []struct {
+		name      string
+		raw       float64
+		pollDelta float64 //difference between two last polls
+		startTime time.Time
+		fail      bool
+		value     float64
+		prev      float64
+	}{
+		{"first send keeps difference of polls", 10, 4, startTime, false, 4, 6},
+		{"two polls since previous send", 30, 5, startTime, false, 20, 10},
+		{"no poll since previous send", 30, 5, startTime, false, 0, 30},
+		{"failed send", 45, 15, startTime, true, 15, 30},
+		{"increments of failed send are sent again", 50, 5, startTime, false, 20, 30},
+		{"counter reset", 8, 8, startTime, false, 8, 50},
+		{"restart detected by start time", 12, 12, restartTime, false, 12, 8},
+		{"after restart", 20, 8, restartTime, false, 8, 12},
+	}
+
+	sink := &testSink{}
+	runner := &SinkRunner{Sink: sink}
+	for _, test := range tests {
+		sink.Fail = test.fail
+		counter := &MetricaSample{Component: "solr1", Name: "handler/requests/standard", Incremental: true,
+			RawValue: test.raw, Value: test.pollDelta, PrevValue: test.raw - test.pollDelta, StartTime: test.startTime}
+		gauge := &MetricaSample{Component: "solr1", Name: "solr/memory/jvm/used", RawValue: 5, Value: 5, PrevValue: 4}
+		err := runner.send([]*MetricaSample{counter, gauge})
+		if (err != nil) != test.fail {
+			t.Errorf("%s: send returned %v", test.name, err)
+		}
+		if len(sink.Received) != 2 || sink.Received[0] != counter {
+			t.Fatalf("%s: sink received %d samples", test.name, len(sink.Received))
+		}
+		if counter.Value != test.value || counter.PrevValue != test.prev {
+			t.Errorf("%s: sent %v with previous value %v, want %v with %v", test.name, counter.Value, counter.PrevValue, test.value, test.prev)
+		}
+		if gauge.Value != 5 || gauge.PrevValue != 4 {
+			t.Errorf("%s: plain metrica is changed to %v with previous value %v", test.name, gauge.Value, gauge.PrevValue)
+		}
+	}
+	if runner.Sends != len(tests) || runner.Errors != 1 {
+		t.Errorf("Runner recorded %d sends and %d errors", runner.Sends, runner.Errors)
+	}
+}
+
+func TestSinkRunnerBufferedSink(t *testing.T) {
+	sink := &testBufferedSink{testSink{Fail: true}}
+	runner := &SinkRunner{Sink: sink}
+	values := []struct {
+		raw   float64
+		value float64
+	}{
+		{10, 10},
+		{25, 15}, //failed batch is kept by sink, so it is not sent again
+		{30, 5},
+	}
+	for i, value := range values {
+		counter := &MetricaSample{Component: "solr1", Name: "handler/requests/standard", Incremental: true, RawValue: value.raw, Value: value.raw}
+		runner.send([]*MetricaSample{counter})
+		if counter.Value != value.value {
+			t.Errorf("Send %d: sent %v, want %v", i, counter.Value, value.value)
+		}
+	}
+}
@@ -2,17 +2,70 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"github.com/yvasiyarov/newrelic_platform_go"
 	"log"
+	"net/http"
+	"os"
+	"strings"
 )
 
+var configFile = flag.String("config", "", "Config file with list of monitored Solr hosts. When set, Solr options are ignored")
 var solrUrl = flag.String("solr-url", "127.0.0.1:8080/", "Solr url")
-var newrelicLicense = flag.String("newrelic-license", "", "Newrelic license")
+var solrCore = flag.String("solr-core", "", "Solr core name, empty for single core Solr")
+var solrUsername = flag.String("solr-username", "", "Solr username for basic authentication")
+var solrPassword = flag.String("solr-password", "", "Solr password for basic authentication")
+var solrConnectionTimeout = flag.Int("solr-connection-timeout", SOLR_CONNECTION_TIMEOUT, "Timeout of connection to Solr in seconds")
+var solrReadTimeout = flag.Int("solr-read-timeout", SOLR_READ_TIMEOUT, "Timeout of Solr request in seconds")
+var solrCaFile = flag.String("solr-ca-file", "", "CA bundle in PEM format to verify Solr certificate, when Solr url starts with https://")
+var solrCertFile = flag.String("solr-cert-file", "", "Client certificate in PEM format for Solr HTTPS connection")
+var solrKeyFile = flag.String("solr-key-file", "", "Key of client certificate in PEM format")
+var solrInsecure = flag.Bool("solr-insecure", false, "Do not verify Solr certificate")
+var allCores = flag.Bool("all-cores", false, "Monitor all Solr cores, one component per core")
+var discover = flag.Bool("discover", false, "Discover all request handlers and caches and report their metrics")
+var rates = flag.String("rates", "", "Comma separated periods of rate variants of incremental metrics: second, minute")
+var includeClasses = flag.String("include-classes", "", "Comma separated list of additionally collected handler and cache classes. Rules can be exact names, prefixes like org.apache.solr.search.* or regular expressions like re:.*Cache$")
+var excludeClasses = flag.String("exclude-classes", "", "Comma separated list of not collected handler and cache classes")
+var includeNames = flag.String("include-names", "", "Comma separated list of additionally collected handler and cache names")
+var excludeNames = flag.String("exclude-names", "", "Comma separated list of not collected handler and cache names")
+var solrApi = flag.String("solr-api", SOLR_API_AUTO, "Solr statistics API: auto, stats(admin/stats.jsp), mbeans(admin/mbeans, Solr 4+) or metrics(admin/metrics, Solr 6.4+)")
+var metricsFile = flag.String("metrics", "", "File with metric definitions. Built-in metrics are used when not set")
+var dumpMetrics = flag.Bool("dump-metrics", false, "Print built-in metric definitions in metrics file format and exit")
+var newrelicLicense = flag.String("newrelic-license", "", "Newrelic license. Can be omitted, when Prometheus exporter is enabled")
+var prometheusListen = flag.String("prometheus-listen", "", "Address of Prometheus /metrics endpoint, like :9112. Disabled when empty")
+var graphiteAddress = flag.String("graphite-address", "", "Carbon address, like 127.0.0.1:2003. Graphite output is disabled when empty")
+var graphiteProtocol = flag.String("graphite-protocol", GRAPHITE_PROTOCOL_PLAINTEXT, "Carbon protocol: plaintext or pickle")
+var graphitePrefix = flag.String("graphite-prefix", "solr", "Prefix of Graphite metric paths")
+var graphiteInterval = flag.Int("graphite-interval", 60, "Send data to Graphite every N seconds")
+var statsdAddress = flag.String("statsd-address", "", "StatsD address, like 127.0.0.1:8125. StatsD output is disabled when empty")
+var statsdProtocol = flag.String("statsd-protocol", STATSD_PROTOCOL_STATSD, "StatsD protocol: statsd or dogstatsd(host, core and handler are sent as tags)")
+var statsdPrefix = flag.String("statsd-prefix", "solr", "Prefix of StatsD metric names")
+var statsdInterval = flag.Int("statsd-interval", 60, "Send data to StatsD every N seconds")
+var influxdbUrl = flag.String("influxdb-url", "", "InfluxDB url, like http://127.0.0.1:8086. InfluxDB output is disabled when empty")
+var influxdbDatabase = flag.String("influxdb-database", "solr", "InfluxDB database")
+var influxdbFile = flag.String("influxdb-file", "", "Write InfluxDB line protocol to file instead of HTTP API, - for stdout")
+var influxdbInterval = flag.Int("influxdb-interval", 60, "Write data to InfluxDB every N seconds")
+var otlpEndpoint = flag.String("otlp-endpoint", "", "OTLP/HTTP receiver url, like http://127.0.0.1:4318. OpenTelemetry export is disabled when empty")
+var otlpInterval = flag.Int("otlp-interval", 60, "Export data to OTLP receiver every N seconds")
+var jsonOutput = flag.String("json-output", "", "Write every poll as JSON line to file or stdout(-). Disabled when empty")
+var jsonMaxSize = flag.Int("json-max-size", JSON_FILE_MAX_SIZE, "JSON output file is rotated, when it is bigger than N megabytes")
+var jsonMaxBackups = flag.Int("json-max-backups", JSON_FILE_MAX_BACKUPS, "Number of rotated JSON output files to keep")
+var jsonInterval = flag.Int("json-interval", 60, "Write data to JSON output every N seconds")
+var checkInterval = flag.Int("check-interval", CHECK_INTERVAL, "Pause in seconds between two queries of check and nagios commands")
+var selectBlocks = flag.String("select-blocks", "", "Comma separated list of stat blocks, printed by discover command. Rules can be exact names, prefixes or regular expressions")
+var selectKeys = flag.String("select-keys", "", "Comma separated list of keys inside stat blocks, printed by discover command")
+var skeleton = flag.Bool("skeleton", false, "Discover command prints metric definitions for selected keys in metrics file format")
+var nagiosThresholds StringListFlag
+var alertRules StringListFlag
+var alertWebhook = flag.String("alert-webhook", "", "Url, where alert notifications are posted as JSON. Alerts are only logged when empty")
+var alertInterval = flag.Int("alert-interval", 60, "Evaluate alert rules every N seconds")
+var statusListen = flag.String("status-listen", "", "Address of agent /status and /healthz endpoints, like :9113. Disabled when empty")
 var verbose = flag.Bool("verbose", false, "Verbose mode")
 
 const (
 	MIN_PAUSE_TIME          = 30 //do not query sphinx often than once in 30 seconds
-	SOLR_CONNECTION_TIMEOUT = 0  //no timeout
+	SOLR_CONNECTION_TIMEOUT = 10 //seconds
+	SOLR_READ_TIMEOUT       = 30 //seconds
 	NEWRELIC_POLL_INTERVAL  = 60 //Send data to newrelic every 60 seconds
 
 	COMPONENT_NAME = "Solr"
@@ -20,45 +73,247 @@ const (
 	AGENT_VERSION  = "0.0.1"
 )
 
-func addMetrcasToComponent(component newrelic_platform_go.IComponent, metricas []newrelic_platform_go.IMetrica) {
-	for _, m := range metricas {
-		component.AddMetrica(m)
+// Value of command line option, which can be repeated
+type StringListFlag []string
+
+func (list *StringListFlag) String() string {
+	return strings.Join(*list, ", ")
+}
+
+func (list *StringListFlag) Set(value string) error {
+	*list = append(*list, value)
+	return nil
+}
+
+// Solr host settings, passed with command line options
+func flagsHostConfig() *SolrHostConfig {
+	return &SolrHostConfig{
+		Name:               COMPONENT_NAME,
+		SolrUrl:            *solrUrl,
+		CoreName:           *solrCore,
+		AllCores:           *allCores,
+		Discover:           *discover,
+		Rates:              splitFilterRules(*rates),
+		SolrApi:            *solrApi,
+		PollInterval:       MIN_PAUSE_TIME,
+		Username:           *solrUsername,
+		Password:           *solrPassword,
+		ConnectionTimeout:  *solrConnectionTimeout,
+		ReadTimeout:        *solrReadTimeout,
+		CaFile:             *solrCaFile,
+		CertFile:           *solrCertFile,
+		KeyFile:            *solrKeyFile,
+		InsecureSkipVerify: *solrInsecure,
+		IncludeClasses:     splitFilterRules(*includeClasses),
+		ExcludeClasses:     splitFilterRules(*excludeClasses),
+		IncludeNames:       splitFilterRules(*includeNames),
+		ExcludeNames:       splitFilterRules(*excludeNames),
 	}
 }
 
 func plainMetricasBuilder(metricas []*Metrica, dataSource *MetricsDataSource) []newrelic_platform_go.IMetrica {
 	result := make([]newrelic_platform_go.IMetrica, len(metricas))
 	for i, m := range metricas {
-		m.DataSource = dataSource
-		result[i] = m
+		metrica := *m
+		metrica.DataSource = dataSource
+		result[i] = &metrica
 	}
 	return result
 }
+//Incremental metricas with their rate variants, enabled for data source
 func incrementalMetricasBuilder(metricas []*Metrica, dataSource *MetricsDataSource) []newrelic_platform_go.IMetrica {
-	incMetricas := make([]newrelic_platform_go.IMetrica, len(metricas))
-	for i, m := range metricas {
-		m.DataSource = dataSource
-		incMetricas[i] = &IncrementalMetrica{*m}
+	incMetricas := make([]newrelic_platform_go.IMetrica, 0, len(metricas)*(1+len(dataSource.Rates)))
+	for _, m := range metricas {
+		incMetrica := &IncrementalMetrica{*m}
+		incMetrica.DataSource = dataSource
+		incMetricas = append(incMetricas, incMetrica)
+		for _, rate := range dataSource.Rates {
+			incMetricas = append(incMetricas, newRateMetrica(m, rate, dataSource))
+		}
 	}
 	return incMetricas
 }
 
+func availabilityMetricasBuilder(metricas []*AvailabilityMetrica, dataSource *MetricsDataSource) []newrelic_platform_go.IMetrica {
+	result := make([]newrelic_platform_go.IMetrica, len(metricas))
+	for i, m := range metricas {
+		metrica := *m
+		metrica.DataSource = dataSource
+		result[i] = &metrica
+	}
+	return result
+}
+
+func cacheMetricasBuilder(metricas []*CacheMetrica, dataSource *MetricsDataSource) []newrelic_platform_go.IMetrica {
+	result := make([]newrelic_platform_go.IMetrica, len(metricas))
+	for i, m := range metricas {
+		metrica := *m
+		metrica.DataSource = dataSource
+		result[i] = &metrica
+	}
+	return result
+}
+
+// Command is the first argument or the first one after options:
+// solr_agent check --solr-url=... and solr_agent --solr-url=... check are the same.
+// Options after command are parsed too, any other argument is an error
+func parseCommandLine() (string, error) {
+	command := ""
+	args := os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+	flag.CommandLine.Parse(args)
+	if command == "" && flag.NArg() > 0 {
+		command = flag.Arg(0)
+		flag.CommandLine.Parse(flag.Args()[1:])
+	}
+	if flag.NArg() > 0 {
+		return command, fmt.Errorf("Unexpected argument: %s\n", flag.Arg(0))
+	}
+	return command, nil
+}
+
+func init() {
+	flag.Var(&alertRules, "alert-rule", "Alert rule, like \"handler/errors/standard > 10 for 3 intervals\". Can be repeated")
+	flag.Var(&nagiosThresholds, "threshold", "Threshold of nagios command: metric name, warning and critical ranges in Nagios format, like handler/errors/standard;5;10. Can be repeated")
+}
+
+// Nagios treats exit code 1 as warning, so errors of nagios command are reported with unknown status
+func exitWithError(command string, format string, args ...interface{}) {
+	if command == COMMAND_NAGIOS {
+		fmt.Printf("SOLR UNKNOWN - "+format, args...)
+		os.Exit(NAGIOS_UNKNOWN)
+	}
+	log.Fatalf(format, args...)
+}
+
+func httpServeMux(servers map[string]*http.ServeMux, address string) *http.ServeMux {
+	if _, ok := servers[address]; !ok {
+		servers[address] = http.NewServeMux()
+	}
+	return servers[address]
+}
+
 func main() {
-	flag.Parse()
+	command, err := parseCommandLine()
+	if err != nil {
+		exitWithError(command, "%v", err)
+	}
+
+	if *dumpMetrics {
+		content, err := DumpMetricas(plainMetricas, incrementalMetricas)
+		if err != nil {
+			log.Fatalf("Can not dump metrics: %v\n", err)
+		}
+		fmt.Println(string(content))
+		return
+	}
+	if *metricsFile != "" {
+		if plainMetricas, incrementalMetricas, err = LoadMetricas(*metricsFile); err != nil {
+			exitWithError(command, "Invalid metrics file: %v", err)
+		}
+	}
 
-	if *newrelicLicense == "" {
-		log.Fatalf("Please, pass a valid newrelic license key.\n Use --help to get more information about available options\n")
+	config := &AgentConfig{Hosts: []*SolrHostConfig{flagsHostConfig()}}
+	if *configFile != "" {
+		if config, err = LoadConfig(*configFile); err != nil {
+			exitWithError(command, "Invalid config: %v", err)
+		}
+	} else if err := config.Validate(); err != nil {
+		exitWithError(command, "%v Use --help to get more information about available options\n", err)
 	}
-    log.Printf("Total metrics:%d\n", len(plainMetricas) + len(incrementalMetricas))
 
-	plugin := newrelic_platform_go.NewNewrelicPlugin(AGENT_VERSION, *newrelicLicense, NEWRELIC_POLL_INTERVAL)
-	component := newrelic_platform_go.NewPluginComponent(COMPONENT_NAME, AGENT_GUID)
-	plugin.AddComponent(component)
+	switch command {
+	case "":
+	case COMMAND_CHECK:
+		os.Exit(RunCheck(config, *checkInterval, os.Stdout))
+	case COMMAND_NAGIOS:
+		thresholds, err := NewNagiosThresholds(nagiosThresholds)
+		if err != nil {
+			exitWithError(command, "%v", err)
+		}
+		os.Exit(RunNagiosCheck(config, thresholds, *checkInterval, os.Stdout))
+	case COMMAND_DISCOVER:
+		selection, err := NewDiscoverSelection(splitFilterRules(*selectBlocks), splitFilterRules(*selectKeys))
+		if err != nil {
+			log.Fatalf("%v Use --help to get more information about available options\n", err)
+		}
+		os.Exit(RunDiscover(config, selection, *skeleton, os.Stdout))
+	default:
+		log.Fatalf("Unknown command %s. Use --help to get more information about available options\n", command)
+	}
 
-	ds := NewMetricsDataSource(*solrUrl, SOLR_CONNECTION_TIMEOUT)
-	addMetrcasToComponent(component, plainMetricasBuilder(plainMetricas, ds))
-	addMetrcasToComponent(component, incrementalMetricasBuilder(incrementalMetricas, ds))
+	if *newrelicLicense == "" && *prometheusListen == "" && *graphiteAddress == "" && *statsdAddress == "" &&
+		*influxdbUrl == "" && *influxdbFile == "" && *otlpEndpoint == "" && *jsonOutput == "" &&
+		len(alertRules) == 0 {
+		log.Fatalf("Please, pass a valid newrelic license key or configure another output.\n Use --help to get more information about available options\n")
+	}
+	log.Printf("Total metrics:%d\n", len(plainMetricas)+len(incrementalMetricas))
 
-	plugin.Verbose = *verbose
-	plugin.Run()
+	agent := NewSolrAgent(config)
+	agent.Verbose = *verbose
+	if *newrelicLicense != "" {
+		agent.AddSink(NewNewrelicSink(*newrelicLicense, NEWRELIC_POLL_INTERVAL, *verbose), NEWRELIC_POLL_INTERVAL)
+	}
+	if *graphiteAddress != "" {
+		sink, err := NewGraphiteSink(*graphiteAddress, *graphiteProtocol, *graphitePrefix)
+		if err != nil {
+			log.Fatalf("%v Use --help to get more information about available options\n", err)
+		}
+		agent.AddSink(sink, *graphiteInterval)
+	}
+	if *statsdAddress != "" {
+		sink, err := NewStatsdSink(*statsdAddress, *statsdProtocol, *statsdPrefix)
+		if err != nil {
+			log.Fatalf("%v Use --help to get more information about available options\n", err)
+		}
+		agent.AddSink(sink, *statsdInterval)
+	}
+	if *influxdbUrl != "" || *influxdbFile != "" {
+		var sink *InfluxdbSink
+		var err error
+		if *influxdbFile != "" {
+			sink, err = NewInfluxdbFileSink(*influxdbFile)
+		} else {
+			sink, err = NewInfluxdbHttpSink(*influxdbUrl, *influxdbDatabase)
+		}
+		if err != nil {
+			log.Fatalf("%v Use --help to get more information about available options\n", err)
+		}
+		agent.AddSink(sink, *influxdbInterval)
+	}
+	if *otlpEndpoint != "" {
+		agent.AddSink(NewOtlpSink(*otlpEndpoint), *otlpInterval)
+	}
+	if *jsonOutput != "" {
+		sink, err := NewJsonSink(*jsonOutput, *jsonMaxSize, *jsonMaxBackups)
+		if err != nil {
+			log.Fatalf("%v Use --help to get more information about available options\n", err)
+		}
+		agent.AddSink(sink, *jsonInterval)
+	}
+	if len(alertRules) > 0 {
+		rules, err := NewAlertRules(alertRules)
+		if err != nil {
+			log.Fatalf("%v Use --help to get more information about available options\n", err)
+		}
+		agent.AddSink(NewAlertSink(rules, *alertWebhook), *alertInterval)
+	}
+	//Prometheus exporter and status server can share the same address
+	httpServers := make(map[string]*http.ServeMux)
+	if *prometheusListen != "" {
+		log.Printf("Prometheus metrics are served on %s/metrics\n", *prometheusListen)
+		NewPrometheusExporter(agent).Register(httpServeMux(httpServers, *prometheusListen))
+	}
+	if *statusListen != "" {
+		log.Printf("Agent status is served on %s/status and %s/healthz\n", *statusListen, *statusListen)
+		NewStatusServer(agent).Register(httpServeMux(httpServers, *statusListen))
+	}
+	for address, mux := range httpServers {
+		go func(address string, mux *http.ServeMux) {
+			log.Fatalf("HTTP server on %s stopped: %v\n", address, http.ListenAndServe(address, mux))
+		}(address, mux)
+	}
+	agent.Run()
 }
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+//HTTP client for one Solr host: connect and read timeouts, HTTPS with custom CA bundle and client certificate
+func NewSolrHttpClient(host *SolrHostConfig) (*http.Client, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: host.InsecureSkipVerify}
+	if host.CaFile != "" {
+		caCerts, err := ioutil.ReadFile(host.CaFile)
+		if err != nil {
+			return nil, fmt.Errorf("Can not read CA bundle: %v\n", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(caCerts) {
+			return nil, fmt.Errorf("CA bundle %s does not contain PEM certificates\n", host.CaFile)
+		}
+	}
+	if host.CertFile != "" || host.KeyFile != "" {
+		certificate, err := tls.LoadX509KeyPair(host.CertFile, host.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("Can not load client certificate: %v\n", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+
+	dialer := &net.Dialer{Timeout: time.Duration(host.ConnectionTimeout) * time.Second}
+	transport := &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		Dial:                dialer.Dial,
+		TLSClientConfig:     tlsConfig,
+		TLSHandshakeTimeout: time.Duration(host.ConnectionTimeout) * time.Second,
+	}
+	client := &http.Client{
+		Transport: transport,
+		Timeout:   time.Duration(host.ReadTimeout) * time.Second,
+	}
+	return client, nil
+}
+
+//Solr responded with non-200 status, so its statistic is not available
+type SolrHttpError struct {
+	Url        string
+	StatusCode int
+	Status     string
+}
+
+func (err *SolrHttpError) Error() string {
+	return fmt.Sprintf("Solr returned %s on %s\n", err.Status, err.Url)
+}
+
+//Solr does not have requested handler or page
+func isSolrNotFound(err error) bool {
+	httpError, ok := err.(*SolrHttpError)
+	return ok && httpError.StatusCode == http.StatusNotFound
+}
+
+func checkSolrResponse(resp *http.Response) error {
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+	url := ""
+	if resp.Request != nil {
+		url = resp.Request.URL.String()
+	}
+	return &SolrHttpError{Url: url, StatusCode: resp.StatusCode, Status: resp.Status}
+}
+
+//Solr urls are configured without scheme by default, like 127.0.0.1:8983/solr/
+func solrRequestUrl(url string) string {
+	if strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://") {
+		return url
+	}
+	return "http://" + url
+}
+
+//Send GET request to Solr, with basic authentication if credentials are set
+func solrGet(client *http.Client, url string, username string, password string) (*http.Response, error) {
+	req, err := http.NewRequest("GET", solrRequestUrl(url), nil)
+	if err != nil {
+		return nil, err
+	}
+	if username != "" || password != "" {
+		req.SetBasicAuth(username, password)
+	}
+	return client.Do(req)
+}
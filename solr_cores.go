@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"sort"
+)
+
+//Structure used to parse JSON response of CoreAdmin STATUS action
+type SolrCoresResponse struct {
+	Status map[string]struct {
+		Name string `json:"name"`
+	} `json:"status"`
+}
+
+//Keeps one agent component per Solr core.
+//List of cores is refreshed periodically, so added and removed cores are picked up on the fly
+type SolrCoresMonitor struct {
+	Host       *SolrHostConfig
+	Agent      *SolrAgent
+	Components map[string]*SolrComponent
+}
+
+func NewSolrCoresMonitor(agent *SolrAgent, host *SolrHostConfig) *SolrCoresMonitor {
+	monitor := &SolrCoresMonitor{
+		Host:       host,
+		Agent:      agent,
+		Components: make(map[string]*SolrComponent),
+	}
+	return monitor
+}
+
+func (monitor *SolrCoresMonitor) client() *http.Client {
+	if monitor.Host.Client == nil {
+		monitor.Host.Client, _ = NewSolrHttpClient(&SolrHostConfig{ConnectionTimeout: SOLR_CONNECTION_TIMEOUT, ReadTimeout: SOLR_READ_TIMEOUT})
+	}
+	return monitor.Host.Client
+}
+
+//Query names of all cores, loaded by Solr
+func (monitor *SolrCoresMonitor) QueryCoreNames() ([]string, error) {
+	resp, err := solrGet(monitor.client(), monitor.Host.SolrUrl+"admin/cores?action=STATUS&indexInfo=false&wt=json", monitor.Host.Username, monitor.Host.Password)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+	if err := checkSolrResponse(resp); err != nil {
+		return nil, err
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	response := SolrCoresResponse{}
+	err = json.Unmarshal(body, &response)
+	if err != nil {
+		return nil, err
+	}
+
+	coreNames := make([]string, 0, len(response.Status))
+	for coreName := range response.Status {
+		coreNames = append(coreNames, coreName)
+	}
+	sort.Strings(coreNames)
+	return coreNames, nil
+}
+
+//Add components for new cores and remove components of unloaded cores
+func (monitor *SolrCoresMonitor) Refresh() error {
+	coreNames, err := monitor.QueryCoreNames()
+	if err != nil {
+		return err
+	}
+	monitor.UpdateCores(coreNames)
+	return nil
+}
+
+//Sync components with list of loaded cores
+func (monitor *SolrCoresMonitor) UpdateCores(coreNames []string) {
+	loadedCores := make(map[string]bool, len(coreNames))
+	for _, coreName := range coreNames {
+		loadedCores[coreName] = true
+		if _, ok := monitor.Components[coreName]; ok {
+			continue
+		}
+
+		log.Printf("Start monitoring of Solr core %s on %s\n", coreName, monitor.Host.Name)
+		component := newSolrComponent(monitor.Host.Name+"/"+coreName, NewMetricsDataSource(monitor.Host, coreName))
+		monitor.Components[coreName] = component
+		monitor.Agent.addComponent(component)
+	}
+
+	for coreName, component := range monitor.Components {
+		if loadedCores[coreName] {
+			continue
+		}
+
+		log.Printf("Stop monitoring of Solr core %s on %s\n", coreName, monitor.Host.Name)
+		monitor.Agent.removeComponent(component)
+		delete(monitor.Components, coreName)
+	}
+}
@@ -1,21 +1,35 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 )
 
+//Categories of statistic blocks, used to discover handlers and caches
+const (
+	SOLR_CATEGORY_QUERY_HANDLER  = "QUERYHANDLER"
+	SOLR_CATEGORY_UPDATE_HANDLER = "UPDATEHANDLER"
+	SOLR_CATEGORY_CACHE          = "CACHE"
+)
+
 type SolrStatisticData map[string]ISolrHandlerStat
 type ISolrHandlerStat interface {
 	Parse(info interface{}) error
 	GetName() string
+	GetClassName() string
+	GetCategory() string
+	GetKeys() []string
 	GetValue(key string) float64
+	LookupValue(key string) (float64, bool)
 }
 
 type SolrHandlerStat struct {
 	Name        string
 	ClassName   string
+	Category    string
 	MetricaData map[string]float64
 }
 
@@ -23,6 +37,41 @@ func (stat *SolrHandlerStat) GetName() string {
 	return stat.Name
 }
 
+func (stat *SolrHandlerStat) GetClassName() string {
+	return stat.ClassName
+}
+
+func (stat *SolrHandlerStat) GetCategory() string {
+	return stat.Category
+}
+
+//Sorted names of all numeric values of the block
+func (stat *SolrHandlerStat) GetKeys() []string {
+	keys := make([]string, 0, len(stat.MetricaData))
+	for key := range stat.MetricaData {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+//Map category names of admin/mbeans and metrics API of different Solr versions to
+//categories of admin/stats.jsp. Empty category is returned for everything except handlers and caches
+func normalizeCategory(category string, name string) string {
+	switch category {
+	case "CACHE":
+		return SOLR_CATEGORY_CACHE
+	case "UPDATEHANDLER":
+		return SOLR_CATEGORY_UPDATE_HANDLER
+	case "QUERYHANDLER", "QUERY", "UPDATE", "ADMIN", "REPLICATION":
+		if name == "updateHandler" {
+			return SOLR_CATEGORY_UPDATE_HANDLER
+		}
+		return SOLR_CATEGORY_QUERY_HANDLER
+	}
+	return ""
+}
+
 func (stat *SolrHandlerStat) GetValue(key string) float64 {
 	if v, ok := stat.MetricaData[key]; ok {
 		return v
@@ -30,10 +79,22 @@ func (stat *SolrHandlerStat) GetValue(key string) float64 {
 	return 0
 }
 
+func (stat *SolrHandlerStat) LookupValue(key string) (float64, bool) {
+	v, ok := stat.MetricaData[key]
+	return v, ok
+}
+
+//Used heap in percents of max heap size
+func setJvmMemoryUsedPercent(data map[string]float64) {
+	if max := data["jvm_memory_max"]; max > 0 {
+		data["jvm_memory_used_percent"] = data["jvm_memory_used"] / max * 100
+	}
+}
+
 func (stat *SolrHandlerStat) Parse(handlerInfo interface{}) error {
 	switch info := handlerInfo.(type) {
 	default:
-		return fmt.Errorf("Parse of %#v is not implemented\n")
+		return fmt.Errorf("Parse of %#v is not implemented\n", handlerInfo)
 	case *SolrSystemResponse:
 		{
 			stat.Name = "Solr"
@@ -57,6 +118,13 @@ func (stat *SolrHandlerStat) Parse(handlerInfo interface{}) error {
 							stat.MetricaData["jvm_memory_"+intValue.Name] = value
 						}
 					}
+					//uptime is in jmx block
+					for _, intValue := range item.NestedIntValues {
+						value, err := strconv.ParseFloat(strings.TrimSpace(intValue.Value), 64)
+						if err == nil {
+							stat.MetricaData["jvm_"+intValue.Name] = value
+						}
+					}
 				}
 				if itemName == "system" {
 					for _, intValue := range item.IntValues {
@@ -68,6 +136,7 @@ func (stat *SolrHandlerStat) Parse(handlerInfo interface{}) error {
 					}
 				}
 			}
+			setJvmMemoryUsedPercent(stat.MetricaData)
 			return nil
 		}
 	case *SolrQueryHandlerInfo:
@@ -77,8 +146,24 @@ func (stat *SolrHandlerStat) Parse(handlerInfo interface{}) error {
 			for _, statItem := range info.Stats {
 				value, err := strconv.ParseFloat(strings.TrimSpace(statItem.Value), 64)
 				if err == nil {
-                    stat.MetricaData[statItem.Name] = value
-                }
+					stat.MetricaData[statItem.Name] = value
+				}
+			}
+		}
+	case *SolrMbeansInfo:
+		{
+			stat.Name = strings.TrimSpace(info.Name)
+			stat.MetricaData = make(map[string]float64, len(info.Stats))
+			for statName, statValue := range info.Stats {
+				switch value := statValue.(type) {
+				case float64:
+					stat.MetricaData[statName] = value
+				case string:
+					// some stats(like cache hitratio) are serialized as strings
+					if floatValue, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+						stat.MetricaData[statName] = floatValue
+					}
+				}
 			}
 		}
 	}
@@ -109,16 +194,50 @@ type SolrQueryHandlerInfoItem struct {
 	Value string `xml:",innerxml"`
 }
 
+// Set of structures used to parse JSON response of admin/mbeans handler
+type SolrMbeansResponse struct {
+	SolrMbeans []json.RawMessage `json:"solr-mbeans"`
+}
+type SolrMbeansInfo struct {
+	Name      string                 `json:"-"`
+	ClassName string                 `json:"class"`
+	Stats     map[string]interface{} `json:"stats"`
+}
+
+// Structure used to parse JSON response of admin/metrics handler in compact form.
+// Every registry(solr.jvm, solr.node, solr.core.<name>...) is a map of metric names to
+// numbers, strings or nested maps for meters, timers and caches
+type SolrMetricsResponse struct {
+	Metrics map[string]map[string]interface{} `json:"metrics"`
+}
+
 // Set of structures used to parse XML response with information about OS and JVM
 type SolrSystemResponse struct {
 	Info []SolrSystemInfoItem `xml:"lst"`
 }
 type SolrSystemInfoItem struct {
-	ItemName     string                    `xml:"name,attr"`
-	IntValues    []SolrSystemInfoItemValue `xml:"long"`
-	MemoryValues []SolrSystemInfoItemValue `xml:"lst>str"`
+	ItemName        string                    `xml:"name,attr"`
+	IntValues       []SolrSystemInfoItemValue `xml:"long"`
+	MemoryValues    []SolrSystemInfoItemValue `xml:"lst>str"`
+	NestedIntValues []SolrSystemInfoItemValue `xml:"lst>long"`
+	StrValues       []SolrSystemInfoItemValue `xml:"str"`
 }
 type SolrSystemInfoItemValue struct {
 	Name  string `xml:"name,attr"`
 	Value string `xml:",innerxml"`
 }
+
+//Solr version from lucene block, empty if it is not reported
+func (response *SolrSystemResponse) SolrVersion() string {
+	for _, item := range response.Info {
+		if strings.TrimSpace(item.ItemName) != "lucene" {
+			continue
+		}
+		for _, value := range item.StrValues {
+			if value.Name == "solr-spec-version" {
+				return strings.TrimSpace(value.Value)
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	STATSD_PROTOCOL_STATSD    = "statsd"
+	STATSD_PROTOCOL_DOGSTATSD = "dogstatsd"
+
+	STATSD_MAX_PACKET_SIZE = 1432 //fits into ethernet MTU
+)
+
+var statsdInvalidChars = regexp.MustCompile("[^a-zA-Z0-9_-]+")
+var statsdInvalidTagChars = regexp.MustCompile("[,|#\\s]+")
+
+//Sends plain metricas as gauges and incremental ones as counters to StatsD daemon over UDP.
+//DogStatsD receives host, core and handler as tags, plain StatsD gets host and core inside metric name
+type StatsdSink struct {
+	Address  string
+	Protocol string
+	Prefix   string
+
+	connection net.Conn
+}
+
+func NewStatsdSink(address string, protocol string, prefix string) (*StatsdSink, error) {
+	if protocol != STATSD_PROTOCOL_STATSD && protocol != STATSD_PROTOCOL_DOGSTATSD {
+		return nil, fmt.Errorf("Unknown StatsD protocol: %s\n", protocol)
+	}
+	connection, err := net.Dial("udp", address)
+	if err != nil {
+		return nil, fmt.Errorf("Can not connect to StatsD: %v\n", err)
+	}
+	sink := &StatsdSink{
+		Address:    address,
+		Protocol:   protocol,
+		Prefix:     strings.Trim(prefix, "."),
+		connection: connection,
+	}
+	return sink, nil
+}
+
+func (sink *StatsdSink) GetName() string {
+	return sink.Protocol
+}
+
+func (sink *StatsdSink) Send(batch []*MetricaSample) error {
+	var packet bytes.Buffer
+	for _, sample := range batch {
+		if math.IsNaN(sample.Value) || math.IsInf(sample.Value, 0) {
+			continue
+		}
+		line := sink.formatSample(sample)
+		if packet.Len() > 0 && packet.Len()+len(line)+1 > STATSD_MAX_PACKET_SIZE {
+			if err := sink.write(packet.Bytes()); err != nil {
+				return err
+			}
+			packet.Reset()
+		}
+		if packet.Len() > 0 {
+			packet.WriteByte('\n')
+		}
+		packet.WriteString(line)
+	}
+	if packet.Len() > 0 {
+		return sink.write(packet.Bytes())
+	}
+	return nil
+}
+
+func (sink *StatsdSink) write(packet []byte) error {
+	_, err := sink.connection.Write(packet)
+	return err
+}
+
+//Incremental metricas are sent as counters with difference since previous interval,
+//so StatsD aggregates them in the same way as application counters
+func (sink *StatsdSink) formatSample(sample *MetricaSample) string {
+	metricType := "g"
+	if sample.Incremental {
+		metricType = "c"
+	}
+	value := strconv.FormatFloat(sample.Value, 'f', -1, 64)
+
+	if sink.Protocol == STATSD_PROTOCOL_STATSD {
+		return fmt.Sprintf("%s:%s|%s", statsdMetricName(sink.Prefix, sample, true, ""), value, metricType)
+	}
+
+	handler := sample.HandlerName()
+	tags := []string{"host:" + statsdTagValue(sample.Host)}
+	if sample.Core != "" {
+		tags = append(tags, "core:"+statsdTagValue(sample.Core))
+	}
+	if handler != "" {
+		tags = append(tags, "handler:"+statsdTagValue(handler))
+	}
+	return fmt.Sprintf("%s:%s|%s|#%s", statsdMetricName(sink.Prefix, sample, false, handler), value, metricType, strings.Join(tags, ","))
+}
+
+//Dotted metric name. Host and core are embedded, when StatsD does not support tags.
+//Otherwise segments with handler name are removed and passed as tag:
+//handler/errors/standard becomes solr.handler.errors with handler:standard tag
+func statsdMetricName(prefix string, sample *MetricaSample, embedHost bool, handler string) string {
+	segments := make([]string, 0)
+	if prefix != "" {
+		segments = append(segments, prefix)
+	}
+	if embedHost {
+		segments = append(segments, statsdSegment(sample.Host))
+		if sample.Core != "" {
+			segments = append(segments, statsdSegment(sample.Core))
+		}
+	}
+	for _, part := range metricaNameSegments(sample.Name, handler) {
+		segments = append(segments, statsdSegment(part))
+	}
+	return strings.Join(segments, ".")
+}
+
+func statsdSegment(segment string) string {
+	return strings.Trim(statsdInvalidChars.ReplaceAllString(segment, "_"), "_")
+}
+
+func statsdTagValue(value string) string {
+	return statsdInvalidTagChars.ReplaceAllString(value, "_")
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatsdFormatSample(t *testing.T) {
+	tests := []struct {
+		protocol string
+		sample   *MetricaSample
+		line     string
+	}{
+		{
+			STATSD_PROTOCOL_DOGSTATSD,
+			&MetricaSample{Host: "solr1", Core: "products", Name: "handler/errors/standard", StatBlock: "standard", Value: 3, Incremental: true},
+			"solr.handler.errors:3|c|#host:solr1,core:products,handler:standard",
+		},
+		{
+			STATSD_PROTOCOL_DOGSTATSD,
+			&MetricaSample{Host: "solr1", Name: "handler/requests/update/json", StatBlock: "/update/json", Value: 3, Incremental: true},
+			"solr.handler.requests:3|c|#host:solr1,handler:update/json",
+		},
+		{
+			STATSD_PROTOCOL_DOGSTATSD,
+			&MetricaSample{Host: "solr1", Name: "handler/time_per_request//admin/ping", StatBlock: "/admin/ping", Value: 1.5},
+			"solr.handler.time_per_request:1.5|g|#host:solr1,handler:admin/ping",
+		},
+		{
+			STATSD_PROTOCOL_DOGSTATSD,
+			&MetricaSample{Host: "solr1", Name: "handler/cache/filterCache/hit_ratio", StatBlock: "filterCache", Value: 0.5},
+			"solr.handler.cache.hit_ratio:0.5|g|#host:solr1,handler:filterCache",
+		},
+		{
+			STATSD_PROTOCOL_DOGSTATSD,
+			&MetricaSample{Host: "solr1", Name: "handler/errors/update/json/per_minute", StatBlock: "/update/json", Value: 2},
+			"solr.handler.errors.per_minute:2|g|#host:solr1,handler:update/json",
+		},
+		{
+			STATSD_PROTOCOL_DOGSTATSD,
+			&MetricaSample{Host: "solr 1", Core: "a,b", Name: "solr/memory/jvm/used", StatBlock: "solr", Value: 1024},
+			"solr.solr.memory.jvm.used:1024|g|#host:solr_1,core:a_b",
+		},
+		{
+			STATSD_PROTOCOL_STATSD,
+			&MetricaSample{Host: "solr1", Core: "products", Name: "handler/errors/standard", StatBlock: "standard", Value: 3, Incremental: true},
+			"solr.solr1.products.handler.errors.standard:3|c",
+		},
+		{
+			STATSD_PROTOCOL_STATSD,
+			&MetricaSample{Host: "10.0.0.1:8983", Name: "handler/requests//update/json", StatBlock: "/update/json", Value: 3, Incremental: true},
+			"solr.10_0_0_1_8983.handler.requests.update.json:3|c",
+		},
+	}
+	for _, test := range tests {
+		sink := &StatsdSink{Protocol: test.protocol, Prefix: "solr"}
+		if line := sink.formatSample(test.sample); line != test.line {
+			t.Errorf("%s line of %s = %q, want %q", test.protocol, test.sample.Name, line, test.line)
+		}
+	}
+}
+
+func TestStatsdSink(t *testing.T) {
+	connection, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer connection.Close()
+	connection.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	sink, err := NewStatsdSink(connection.LocalAddr().String(), STATSD_PROTOCOL_DOGSTATSD, ".solr.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sample := &MetricaSample{Host: "solr1", Name: "handler/errors/standard", StatBlock: "standard", Value: 3, Incremental: true}
+	batch := make([]*MetricaSample, 100)
+	for i := range batch {
+		batch[i] = sample
+	}
+	if err := sink.Send(batch); err != nil {
+		t.Fatal(err)
+	}
+
+	line := "solr.handler.errors:3|c|#host:solr1,handler:standard"
+	buffer := make([]byte, 64*1024)
+	lines := 0
+	for lines < len(batch) {
+		n, _, err := connection.ReadFrom(buffer)
+		if err != nil {
+			t.Fatalf("Received %d lines of %d: %v", lines, len(batch), err)
+		}
+		if n > STATSD_MAX_PACKET_SIZE {
+			t.Errorf("Packet of %d bytes is bigger than %d", n, STATSD_MAX_PACKET_SIZE)
+		}
+		for _, received := range strings.Split(string(buffer[:n]), "\n") {
+			if received != line {
+				t.Fatalf("StatsD received %q, want %q", received, line)
+			}
+			lines++
+		}
+	}
+
+	if _, err := NewStatsdSink(connection.LocalAddr().String(), "carbon", "solr"); err == nil {
+		t.Error("Unknown protocol should be rejected")
+	}
+}
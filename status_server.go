@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+)
+
+//Main loop is considered stuck, when list of cores was not refreshed during 3 refresh intervals
+const HEALTHZ_MAX_REFRESH_DELAY = 3 * REFRESH_INTERVAL
+
+//Serves agent diagnostics: /status with poll state of every Solr host and core
+//and their last statistic, /healthz for supervisor liveness probes
+type StatusServer struct {
+	Agent *SolrAgent
+}
+
+type AgentStatus struct {
+	Version         string             `json:"version"`
+	StartTime       time.Time          `json:"start_time"`
+	UptimeSeconds   float64            `json:"uptime_seconds"`
+	LastRefreshTime *time.Time         `json:"last_refresh_time"`
+	Components      []*ComponentStatus `json:"components"`
+	Sinks           []*SinkStatus      `json:"sinks"`
+}
+
+type ComponentStatus struct {
+	Name              string                      `json:"name"`
+	Host              string                      `json:"host"`
+	Core              string                      `json:"core,omitempty"`
+	Url               string                      `json:"url"`
+	Api               string                      `json:"api"`
+	SolrVersion       string                      `json:"solr_version,omitempty"`
+	Up                bool                        `json:"up"`
+	HttpStatus        int                         `json:"http_status"`
+	LastSuccessTime   *time.Time                  `json:"last_success_time"`
+	LastPollTime      *time.Time                  `json:"last_poll_time"`
+	LastPollLatencyMs float64                     `json:"last_poll_latency_ms"`
+	LastError         string                      `json:"last_error,omitempty"`
+	LastErrorTime     *time.Time                  `json:"last_error_time,omitempty"`
+	Polls             int                         `json:"polls"`
+	Errors            int                         `json:"errors"`
+	Restarts          int                         `json:"restarts"`
+	Metrics           int                         `json:"metrics"`
+	StatBlocks        int                         `json:"stat_blocks"`
+	Data              map[string]*StatBlockStatus `json:"data,omitempty"`
+}
+
+type StatBlockStatus struct {
+	Class    string             `json:"class"`
+	Category string             `json:"category,omitempty"`
+	Values   map[string]float64 `json:"values"`
+}
+
+type SinkStatus struct {
+	Name          string     `json:"name"`
+	Interval      int        `json:"interval"`
+	LastSendTime  *time.Time `json:"last_send_time"`
+	LastError     string     `json:"last_error,omitempty"`
+	LastErrorTime *time.Time `json:"last_error_time,omitempty"`
+	Sends         int        `json:"sends"`
+	Errors        int        `json:"errors"`
+}
+
+func NewStatusServer(agent *SolrAgent) *StatusServer {
+	return &StatusServer{Agent: agent}
+}
+
+func (server *StatusServer) Register(mux *http.ServeMux) {
+	mux.HandleFunc("/status", server.ServeStatus)
+	mux.HandleFunc("/healthz", server.ServeHealthz)
+}
+
+//Status of agent as JSON. Statistic snapshots are omitted with ?data=false
+func (server *StatusServer) ServeStatus(w http.ResponseWriter, r *http.Request) {
+	status := server.Agent.Status(r.URL.Query().Get("data") != "false")
+	content, err := json.MarshalIndent(status, "", "    ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(content)
+}
+
+//Agent is alive, while its main loop refreshes list of cores
+func (server *StatusServer) ServeHealthz(w http.ResponseWriter, r *http.Request) {
+	lastRefreshTime := server.Agent.GetLastRefreshTime()
+	if lastRefreshTime.IsZero() {
+		lastRefreshTime = server.Agent.StartTime
+	}
+	if time.Since(lastRefreshTime) <= HEALTHZ_MAX_REFRESH_DELAY*time.Second {
+		fmt.Fprintln(w, "ok")
+		return
+	}
+	http.Error(w, fmt.Sprintf("agent is stuck: last refresh at %s", lastRefreshTime.Format(time.RFC3339)), http.StatusServiceUnavailable)
+}
+
+//Snapshot of agent state. Components are read under agent lock, their data from current snapshots
+func (agent *SolrAgent) Status(withData bool) *AgentStatus {
+	agent.mutex.Lock()
+	defer agent.mutex.Unlock()
+
+	status := &AgentStatus{
+		Version:         AGENT_VERSION,
+		StartTime:       agent.StartTime,
+		UptimeSeconds:   time.Since(agent.StartTime).Seconds(),
+		LastRefreshTime: statusTime(agent.GetLastRefreshTime()),
+		Components:      make([]*ComponentStatus, 0, len(agent.Components)),
+		Sinks:           make([]*SinkStatus, 0, len(agent.Sinks)),
+	}
+	for _, component := range agent.Components {
+		status.Components = append(status.Components, newComponentStatus(component, withData))
+	}
+	for _, runner := range agent.Sinks {
+		status.Sinks = append(status.Sinks, runner.Status())
+	}
+	return status
+}
+
+func newComponentStatus(component *SolrComponent, withData bool) *ComponentStatus {
+	ds := component.DataSource
+	snapshot := ds.Snapshot()
+	status := &ComponentStatus{
+		Name:              component.Name,
+		Host:              ds.HostName,
+		Core:              ds.CoreName,
+		Url:               ds.CoreUrl(),
+		Api:               snapshot.SolrApi,
+		SolrVersion:       snapshot.SolrVersion,
+		Up:                snapshot.Available,
+		HttpStatus:        snapshot.HttpStatus,
+		LastSuccessTime:   statusTime(snapshot.LastUpdateTime),
+		LastPollTime:      statusTime(snapshot.LastPollTime),
+		LastPollLatencyMs: float64(snapshot.LastPollDuration) / float64(time.Millisecond),
+		LastErrorTime:     statusTime(snapshot.LastErrorTime),
+		Polls:             snapshot.Polls,
+		Errors:            snapshot.Errors,
+		Restarts:          snapshot.Restarts,
+		Metrics:           len(component.Metricas),
+		StatBlocks:        len(snapshot.LastData),
+	}
+	if snapshot.LastError != nil {
+		status.LastError = strings.TrimSpace(snapshot.LastError.Error())
+	}
+
+	if withData {
+		status.Data = make(map[string]*StatBlockStatus, len(snapshot.LastData))
+		for blockName, block := range snapshot.LastData {
+			blockStatus := &StatBlockStatus{
+				Class:    block.GetClassName(),
+				Category: block.GetCategory(),
+				Values:   make(map[string]float64),
+			}
+			for _, key := range block.GetKeys() {
+				//NaN and Inf can not be encoded to JSON
+				if value := block.GetValue(key); !math.IsNaN(value) && !math.IsInf(value, 0) {
+					blockStatus.Values[key] = value
+				}
+			}
+			status.Data[blockName] = blockStatus
+		}
+	}
+	return status
+}
+
+func (runner *SinkRunner) Status() *SinkStatus {
+	runner.mutex.Lock()
+	defer runner.mutex.Unlock()
+
+	status := &SinkStatus{
+		Name:          runner.Sink.GetName(),
+		Interval:      runner.Interval,
+		LastSendTime:  statusTime(runner.LastSendTime),
+		LastErrorTime: statusTime(runner.LastErrorTime),
+		Sends:         runner.Sends,
+		Errors:        runner.Errors,
+	}
+	if runner.LastError != nil {
+		status.LastError = strings.TrimSpace(runner.LastError.Error())
+	}
+	return status
+}
+
+//Zero time is shown as null
+func statusTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}